@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// fieldDiff reports a field with different values in two documents.
+type fieldDiff struct {
+	Field            string
+	Expected, Actual interface{}
+	InExpected       bool
+	InActual         bool
+}
+
+// normalizeJSON converts the document into the generic types created by
+// encoding/json, so documents from different sources can be compared.
+func normalizeJSON(doc map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmp map[string]interface{}
+	err = json.Unmarshal(raw, &tmp)
+	return tmp, err
+}
+
+// flattenDoc returns all fields in doc by dotted field name. Empty objects are
+// kept as values.
+func flattenDoc(doc map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			name := prefix + k
+			if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+				flatten(name+".", sub)
+				continue
+			}
+			fields[name] = v
+		}
+	}
+	flatten("", doc)
+	return fields
+}
+
+// diffDocs compares the normalized documents field by field. The result is
+// sorted by field name.
+func diffDocs(expected, actual map[string]interface{}) []fieldDiff {
+	want, have := flattenDoc(expected), flattenDoc(actual)
+
+	var diffs []fieldDiff
+	for field, v := range want {
+		other, exists := have[field]
+		if !exists || !reflect.DeepEqual(v, other) {
+			diffs = append(diffs, fieldDiff{
+				Field:      field,
+				Expected:   v,
+				Actual:     other,
+				InExpected: true,
+				InActual:   exists,
+			})
+		}
+	}
+	for field, v := range have {
+		if _, exists := want[field]; !exists {
+			diffs = append(diffs, fieldDiff{Field: field, Actual: v, InActual: true})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+func (d fieldDiff) String() string {
+	switch {
+	case !d.InActual:
+		return fmt.Sprintf("- %v: %v", d.Field, jsonString(d.Expected))
+	case !d.InExpected:
+		return fmt.Sprintf("+ %v: %v", d.Field, jsonString(d.Actual))
+	default:
+		return fmt.Sprintf("~ %v: %v (%v) != %v (%v)", d.Field,
+			jsonString(d.Expected), jsonType(d.Expected),
+			jsonString(d.Actual), jsonType(d.Actual))
+	}
+}
+
+func jsonString(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// normalizeIngestDoc removes the ingest metadata from a simulate result
+// document.
+func normalizeIngestDoc(doc map[string]interface{}) {
+	delete(doc, "_ingest")
+}
+
+// normalizeLogstashDoc removes fields added by logstash inputs and the tags
+// used for error handling.
+func normalizeLogstashDoc(doc map[string]interface{}) {
+	delete(doc, "@version")
+	delete(doc, "host")
+	delete(doc, "tags")
+}
+
+// dropLogstashTimestamp removes the @timestamp field logstash adds to every
+// event, if neither the input event nor the reference document have it.
+func dropLogstashTimestamp(event, reference, doc map[string]interface{}) {
+	_, inEvent := event["@timestamp"]
+	_, inReference := reference["@timestamp"]
+	if !inEvent && !inReference {
+		delete(doc, "@timestamp")
+	}
+}
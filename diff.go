@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/urso/bpb/generator"
+)
+
+func cmdDiff() *cobra.Command {
+	var (
+		host        string
+		lsHome      string
+		inFile      string
+		eventFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare Ingest Node and Logstash results",
+		Long: `Run the sample events through the Ingest Node simulate API and Logstash
+and report the fields with different values or types per event.`,
+		Run: runWithPipeline(func(gen *generator.Generator) error {
+			same, err := diffRun(gen, host, lsHome, inFile, eventFormat)
+			if err != nil {
+				return err
+			}
+			if !same {
+				os.Exit(1)
+			}
+			return nil
+		}),
+	}
+	cmd.PersistentFlags().StringVar(&host, "host", "http://localhost:9200", "Ingest node URL")
+	cmd.PersistentFlags().StringVar(&lsHome, "lshome", "", "logstash home path")
+	cmd.PersistentFlags().StringVarP(&inFile, "in", "i", "", "event input file")
+	cmd.PersistentFlags().StringVar(&eventFormat, "format", "plain", "event format (one of plain or json)")
+	return cmd
+}
+
+func diffRun(
+	gen *generator.Generator,
+	host, lsHome string,
+	inFile, eventFormat string,
+) (bool, error) {
+	events, err := readEvents(eventFormat, inFile)
+	if err != nil {
+		return false, err
+	}
+
+	ingestDocs, err := ingestProcess(gen, host, copyEvents(events))
+	if err != nil {
+		return false, fmt.Errorf("ingest: %v", err)
+	}
+
+	lsDocs, err := lsProcess(lsHome, gen, &generator.LogstashCtx{}, copyEvents(events))
+	if err != nil {
+		return false, fmt.Errorf("logstash: %v", err)
+	}
+
+	if len(ingestDocs) != len(lsDocs) {
+		return false, fmt.Errorf("ingest returned %v documents, but logstash returned %v", len(ingestDocs), len(lsDocs))
+	}
+
+	fmt.Println("--- ingest")
+	fmt.Println("+++ logstash")
+
+	same := true
+	for i := range events {
+		ingestDoc, lsDoc := ingestDocs[i], lsDocs[i]
+		normalizeIngestDoc(ingestDoc)
+		normalizeLogstashDoc(lsDoc)
+
+		dropLogstashTimestamp(events[i], ingestDoc, lsDoc)
+
+		ingestDoc, err = normalizeJSON(ingestDoc)
+		if err != nil {
+			return false, err
+		}
+		lsDoc, err = normalizeJSON(lsDoc)
+		if err != nil {
+			return false, err
+		}
+
+		diffs := diffDocs(ingestDoc, lsDoc)
+		if len(diffs) == 0 {
+			continue
+		}
+
+		same = false
+		fmt.Printf("event %v:\n", i)
+		for _, d := range diffs {
+			fmt.Printf("    %v\n", d)
+		}
+	}
+
+	if same {
+		log.Printf("%v events: no differences", len(events))
+	}
+	return same, nil
+}
+
+// copyEvents deep copies the events, so each backend receives the original
+// input.
+func copyEvents(events []map[string]interface{}) []map[string]interface{} {
+	copies := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		raw, _ := json.Marshal(event)
+		json.Unmarshal(raw, &copies[i])
+	}
+	return copies
+}
@@ -25,11 +25,9 @@ func findEventReader(format string) (eventReader, error) {
 }
 
 func readEvents(format, inFile string) ([]map[string]interface{}, error) {
-	type reader func(io.Reader, func(map[string]interface{}) error) error
-
-	r := eventReaders[format]
-	if r == nil {
-		return nil, fmt.Errorf("format '%v' not supported", format)
+	r, err := findEventReader(format)
+	if err != nil {
+		return nil, err
 	}
 
 	var eventSource io.Reader = os.Stdin
@@ -44,7 +42,7 @@ func readEvents(format, inFile string) ([]map[string]interface{}, error) {
 	}
 
 	var events []map[string]interface{}
-	err := r(eventSource, func(event map[string]interface{}) error {
+	err = r(eventSource, func(event map[string]interface{}) error {
 		events = append(events, event)
 		return nil
 	})
@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/urso/bpb/prog/cond"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+)
+
+// conditional executes a processor only if the condition configured via the
+// common `if` setting matches.
+type conditional struct {
+	Processor
+	cond *cond.Cond
+}
+
+// CompileIngest adds the condition to all generated processors. Conditions
+// already present are combined with the new condition.
+func (c *conditional) CompileIngest() ([]ingest.Processor, error) {
+	expr, err := c.cond.CompileIngest()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", c.Name(), err)
+	}
+
+	ps, err := c.Processor.CompileIngest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range ps {
+		addIngestCondition(p, expr)
+	}
+	return ps, nil
+}
+
+func (c *conditional) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	expr, err := c.cond.CompileLogstash()
+	if err != nil {
+		return FilterBlock{}, fmt.Errorf("%v: %v", c.Name(), err)
+	}
+
+	blk, err := c.Processor.CompileLogstash(ctx)
+	if err != nil || len(blk.Block) == 0 {
+		return blk, err
+	}
+
+	blk.Block = ls.MakeBlock(ls.Conditional{
+		Cond: []ls.Case{{Cond: expr, Block: blk.Block}},
+	})
+	return blk, nil
+}
+
+func (c *conditional) CompileLocal() ([]local.Processor, error) {
+	match, err := c.cond.CompileLocal()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", c.Name(), err)
+	}
+
+	ps, err := c.Processor.CompileLocal()
+	if err != nil || len(ps) == 0 {
+		return ps, err
+	}
+
+	return local.Single(func(doc local.Document) error {
+		if !match(doc) {
+			return nil
+		}
+		return local.Run(ps, doc)
+	}), nil
+}
+
+// addIngestCondition sets the processors `if` setting. An existing condition
+// is combined with the new condition.
+func addIngestCondition(p ingest.Processor, expr string) {
+	for _, params := range p {
+		if inner, exists := params["if"]; exists {
+			params["if"] = fmt.Sprintf("(%v) && (%v)", expr, inner)
+		} else {
+			params["if"] = expr
+		}
+	}
+}
@@ -3,9 +3,14 @@ package convert
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
@@ -15,12 +20,9 @@ type convert struct {
 }
 
 type config struct {
-	Field         string   `validate:"required"`
-	To            string   `config:"target_field"`
-	Type          convType `validate:"required"`
-	IgnoreMissing bool     `config:"ignore_missing"`
-	IgnoreFailure bool     `config:"ignore_failure"`
-	DropField     bool     `config:"drop_field"`
+	Field string   `validate:"required"`
+	To    string   `config:"target_field"`
+	Type  convType `validate:"required"`
 }
 
 type convType uint8
@@ -35,9 +37,11 @@ const (
 
 func init() {
 	generator.Register("convert", makeConvert)
+	generator.RegisterIngestImport("convert", importIngest)
+	generator.RegisterLogstashImport("mutate.convert", importLogstash)
 }
 
-func makeConvert(cfg *common.Config) (generator.Processor, error) {
+func makeConvert(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -48,6 +52,21 @@ func makeConvert(cfg *common.Config) (generator.Processor, error) {
 
 func (c *convert) Name() string { return "convert" }
 
+func (c *convert) SourceField() string { return c.Field }
+
+func (c *convert) Flow() (generator.Flow, error) {
+	to := c.To
+	if to == "" {
+		to = c.Field
+	}
+	return generator.Flow{Reads: []string{c.Field}, Writes: []string{to}}, nil
+}
+
+// DefaultOptions enables ignore_missing by default.
+func (c *convert) DefaultOptions() generator.Options {
+	return generator.Options{IgnoreMissing: true}
+}
+
 func (c *convert) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field": c.Field,
@@ -56,28 +75,69 @@ func (c *convert) CompileIngest() ([]ingest.Processor, error) {
 	if c.To != "" {
 		params["target_field"] = c.To
 	}
-	if c.IgnoreMissing {
-		params["ignore_missing"] = true
-	}
-	if c.IgnoreFailure {
-		params["ignore_failure"] = true
-	}
+	return ingest.MakeSingleProcessor("convert", params), nil
+}
+
+// CompileLogstash generates a ruby filter, as mutate convert does not fail on
+// invalid values. Values are parsed with the same rules as in Ingest Node.
+//
+// failure tag: none, need to generate custom tag handling
+func (c *convert) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
 
-	ps := ingest.MakeSingleProcessor("convert", params)
-	if c.DropField {
-		ps = append(ps, ingest.RemoveField(c.Field))
+	to := c.Field
+	if c.To != "" {
+		to = c.To
 	}
-	return ps, nil
+
+	code := strings.Join([]string{
+		fmt.Sprintf("c = lambda { |v| s = v.to_s; %v }", c.Type.ruby()),
+		fmt.Sprintf("v = event.get('%v')", ls.NormalizeField(c.Field)),
+		fmt.Sprintf("raise 'field [%v] not present' if v.nil?", c.Field),
+		fmt.Sprintf("event.set('%v', v.is_a?(Array) ? v.map { |e| c.call(e) } : c.call(v))", ls.NormalizeField(to)),
+	}, "; ")
+	blk := generator.MakeRuby(ctx, code, failureTag, nil)
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "convert", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
 }
 
-func (C *convert) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	return generator.FilterBlock{}, errors.New("TODO (logstash convert)")
+func (c *convert) CompileLocal() ([]local.Processor, error) {
+	convert := func(doc local.Document) error {
+		v, _, err := doc.Field(c.Field, false)
+		if err != nil {
+			return err
+		}
+
+		var converted interface{}
+		if list, ok := v.([]interface{}); ok {
+			tmp := make([]interface{}, len(list))
+			for i, elem := range list {
+				if tmp[i], err = c.Type.convert(elem); err != nil {
+					return err
+				}
+			}
+			converted = tmp
+		} else {
+			if converted, err = c.Type.convert(v); err != nil {
+				return err
+			}
+		}
+
+		to := c.Field
+		if c.To != "" {
+			to = c.To
+		}
+		return doc.Put(to, converted)
+	}
+
+	return local.Single(convert), nil
 }
 
 func defaultConfig() config {
-	return config{
-		IgnoreMissing: true,
-	}
+	return config{}
 }
 
 func (t *convType) Unpack(name string) error {
@@ -92,19 +152,106 @@ func (t *convType) Unpack(name string) error {
 
 func (t convType) String() string {
 	return map[convType]string{
-		convBool:   "bool",
+		convBool:   "boolean",
 		convInt:    "integer",
 		convFloat:  "float",
 		convString: "string",
 	}[t]
 }
 
+func (t convType) convert(v interface{}) (interface{}, error) {
+	s := local.ToString(v)
+	switch t {
+	case convBool:
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("[%v] is not a boolean value, cannot convert to boolean", s)
+	case convInt:
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%v] to integer", s)
+		}
+		return int(i), nil
+	case convFloat:
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%v] to float", s)
+		}
+		return float32(f), nil
+	default:
+		return s, nil
+	}
+}
+
+// ruby returns the ruby code converting the string `s`. Like convert, invalid
+// values raise an error.
+func (t convType) ruby() string {
+	switch t {
+	case convBool:
+		return "case s.downcase when 'true' then true when 'false' then false " +
+			"else raise '[' + s + '] is not a boolean value, cannot convert to boolean' end"
+	case convInt:
+		return `raise 'unable to convert [' + s + '] to integer' unless s =~ /\A[+-]?[0-9]+\z/ && s.to_i.between?(-2147483648, 2147483647); s.to_i`
+	case convFloat:
+		return `raise 'unable to convert [' + s + '] to float' unless s =~ /\A[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?\z/; s.to_f`
+	default:
+		return "s"
+	}
+}
+
 func getConvType(name string) convType {
 	return map[string]convType{
 		"bool":    convBool,
+		"boolean": convBool,
 		"integer": convInt,
 		"int":     convInt,
 		"float":   convFloat,
 		"string":  convString,
 	}[name]
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_field":   "target_field",
+		"type":           "type",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ignore_missing is enabled by default
+	if _, exists := config["ignore_missing"]; !exists {
+		config["ignore_missing"] = false
+	}
+	return generator.MakeImport("convert", config), nil
+}
+
+// importLogstash creates a convert processor per field. Missing fields are
+// ignored, like in Logstash.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	fields, ok := params["convert"].(ls.Params)
+	if !ok {
+		return nil, errors.New("convert must be a hash")
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var configs []map[string]interface{}
+	for _, name := range names {
+		configs = append(configs, generator.MakeImport("convert", map[string]interface{}{
+			"field": ls.FieldPath(name),
+			"type":  fields[name],
+		}))
+	}
+	return configs, nil
+}
@@ -0,0 +1,326 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type csv struct {
+	config
+}
+
+type config struct {
+	Field     string   `validate:"required"`
+	To        []string `config:"target_fields" validate:"required"`
+	Separator string
+	Quote     string
+	Trim      bool
+
+	// EmptyValue is set for empty columns. Empty columns are skipped if not
+	// configured.
+	EmptyValue *string `config:"empty_value"`
+}
+
+func init() {
+	generator.Register("csv", makeCSV)
+	generator.RegisterIngestImport("csv", importIngest)
+	generator.RegisterLogstashImport("csv", importLogstash)
+}
+
+func makeCSV(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	return &csv{config}, nil
+}
+
+func (c *csv) Name() string { return "csv" }
+
+func (c *csv) SourceField() string { return c.Field }
+
+// Flow reports the target fields as written depending on the event, as lines
+// might have less columns than target fields.
+func (c *csv) Flow() (generator.Flow, error) {
+	return generator.Flow{Reads: []string{c.Field}, MayWrite: c.To}, nil
+}
+
+func (c *csv) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"field":         c.Field,
+		"target_fields": c.To,
+		"separator":     c.Separator,
+		"quote":         c.Quote,
+	}
+	if c.Trim {
+		params["trim"] = true
+	}
+	if c.EmptyValue != nil {
+		params["empty_value"] = *c.EmptyValue
+	}
+	return ingest.MakeSingleProcessor("csv", params), nil
+}
+
+// CompileLogstash sets the empty value after parsing, as not supported by the
+// csv filter. Column names are not generated for columns beyond the target
+// fields, such that these are ignored like in Ingest Node. The csv filter can
+// not trim unquoted values only, the line is parsed by a ruby filter if trim is
+// set.
+//
+// failure tag: none, need to generate custom tag handling
+func (c *csv) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	columns := make([]string, len(c.To))
+	for i, field := range c.To {
+		columns[i] = ls.NormalizeField(field)
+	}
+
+	if c.Trim {
+		blk := generator.MakeRuby(ctx, c.rubyParse(columns), failureTag, nil)
+		return generator.FilterBlock{
+			Block:       ls.MakeVerboseBlock(ctx.Verbose, "csv", blk...),
+			FailureTags: []string{failureTag},
+		}, nil
+	}
+
+	params := ls.Params{
+		"source":                    ls.NormalizeField(c.Field),
+		"columns":                   columns,
+		"separator":                 c.Separator,
+		"quote_char":                c.Quote,
+		"skip_empty_columns":        c.EmptyValue == nil,
+		"autogenerate_column_names": false,
+	}
+	params.RemoveTag(failureTag)
+
+	blk := ls.RunWithTags(ls.MakeBlock(ls.MakeFilter("csv", params)), failureTag)
+
+	if c.EmptyValue != nil {
+		code := fmt.Sprintf("[%v].each { |f| v = event.get(f); event.set(f, %v) if event.include?(f) && (v.nil? || v == '') }",
+			"'"+strings.Join(columns, "', '")+"'", generator.RubyString(*c.EmptyValue))
+		blk = append(blk, ls.Conditional{
+			Cond: []ls.Case{{
+				Cond:  ls.Expression(fmt.Sprintf(`"%v" not in [tags]`, failureTag)),
+				Block: ls.MakeBlock(ls.MakeFilter("ruby", ls.Params{"code": code})),
+			}},
+		})
+	}
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "csv", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+// rubyParse creates the ruby code parsing the line like splitLine with trim
+// enabled. Empty columns are skipped or set to the empty value.
+func (c *csv) rubyParse(columns []string) string {
+	sep, _ := utf8.DecodeRuneInString(c.Separator)
+	quote, _ := utf8.DecodeRuneInString(c.Quote)
+
+	empty := "next if x == ''"
+	if c.EmptyValue != nil {
+		empty = fmt.Sprintf("x = %v if x == ''", generator.RubyString(*c.EmptyValue))
+	}
+
+	return strings.Join([]string{
+		fmt.Sprintf("s = event.get('%v')", ls.NormalizeField(c.Field)),
+		fmt.Sprintf("raise 'field [%v] not present as part of path [%v]' if s.nil?", c.Field, c.Field),
+		fmt.Sprintf("sep = %v.chr('UTF-8'); q = %v.chr('UTF-8')", sep, quote),
+		"vals = []; v = ''.dup; quoted = false; closed = false",
+		"flush = lambda { vals << (quoted ? v : v.strip); v = ''.dup; quoted = false; closed = false }",
+		"cs = s.chars; i = 0",
+		"while i < cs.length do c = cs[i]; " +
+			"if quoted && !closed then (if c != q then v << c elsif cs[i + 1] == q then v << q; i += 1 else closed = true end) " +
+			"elsif c == sep then flush.call " +
+			"elsif closed then (raise 'unexpected character [' + c + '] after quote' unless c.strip.empty?) " +
+			"elsif c == q then (raise 'unexpected quote' unless v.strip.empty?); v = ''.dup; quoted = true " +
+			"else v << c end; i += 1 end",
+		"raise 'missing closing quote' if quoted && !closed",
+		"flush.call",
+		fmt.Sprintf("vals.first(%v).each_with_index { |x, j| %v; event.set([%v][j], x) }",
+			len(columns), empty, "'"+strings.Join(columns, "', '")+"'"),
+	}, "; ")
+}
+
+func (c *csv) CompileLocal() ([]local.Processor, error) {
+	sep, _ := utf8.DecodeRuneInString(c.Separator)
+	quote, _ := utf8.DecodeRuneInString(c.Quote)
+
+	parse := func(doc local.Document) error {
+		line, _, err := doc.StringField(c.Field, false)
+		if err != nil {
+			return err
+		}
+
+		values, err := splitLine(line, sep, quote, c.Trim)
+		if err != nil {
+			return err
+		}
+
+		for i, v := range values {
+			if i >= len(c.To) {
+				break
+			}
+			if v == "" {
+				if c.EmptyValue == nil {
+					continue
+				}
+				v = *c.EmptyValue
+			}
+			if err := doc.Put(c.To[i], v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return local.Single(parse), nil
+}
+
+func defaultConfig() config {
+	return config{Separator: ",", Quote: `"`}
+}
+
+func (c *config) Validate() error {
+	if utf8.RuneCountInString(c.Separator) != 1 {
+		return errors.New("separator must be a single character")
+	}
+	if utf8.RuneCountInString(c.Quote) != 1 {
+		return errors.New("quote must be a single character")
+	}
+	return nil
+}
+
+// splitLine splits a line into columns. Quoted columns may contain separators
+// and quotes escaped by doubling. If trim is set, whitespace around unquoted
+// values and around quotes is removed.
+func splitLine(line string, sep, quote rune, trim bool) ([]string, error) {
+	var (
+		values []string
+		value  strings.Builder
+		quoted bool // column started with a quote
+		closed bool // closing quote found
+	)
+
+	flush := func() {
+		v := value.String()
+		if trim && !quoted {
+			v = strings.TrimSpace(v)
+		}
+		values = append(values, v)
+		value.Reset()
+		quoted, closed = false, false
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quoted && !closed:
+			if r != quote {
+				value.WriteRune(r)
+			} else if i+1 < len(runes) && runes[i+1] == quote {
+				value.WriteRune(quote)
+				i++
+			} else {
+				closed = true
+			}
+
+		case r == sep:
+			flush()
+
+		case closed:
+			if !trim || !unicode.IsSpace(r) {
+				return nil, fmt.Errorf("unexpected character '%c' after quote at position %v", r, i)
+			}
+
+		case r == quote:
+			if strings.TrimSpace(value.String()) != "" || (value.Len() > 0 && !trim) {
+				return nil, fmt.Errorf("unexpected quote at position %v", i)
+			}
+			value.Reset()
+			quoted = true
+
+		default:
+			value.WriteRune(r)
+		}
+	}
+	if quoted && !closed {
+		return nil, errors.New("missing closing quote")
+	}
+	flush()
+	return values, nil
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_fields":  "target_fields",
+		"separator":      "separator",
+		"quote":          "quote",
+		"trim":           "trim",
+		"empty_value":    "empty_value",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("csv", config), nil
+}
+
+// importLogstash requires the columns to be configured. Columns beyond the
+// configured columns are ignored. Empty columns are kept as empty strings,
+// unless skip_empty_columns is set.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source":                    "field",
+		"columns":                   "target_fields",
+		"separator":                 "separator",
+		"quote_char":                "quote",
+		"skip_empty_columns":        "skip_empty_columns",
+		"autogenerate_column_names": "autogenerate_column_names",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	skip, _ := config["skip_empty_columns"].(bool)
+	delete(config, "skip_empty_columns")
+	if !skip {
+		config["empty_value"] = ""
+	}
+	delete(config, "autogenerate_column_names")
+
+	if _, exists := config["field"]; !exists {
+		config["field"] = "message"
+	}
+	columns, ok := config["target_fields"].([]interface{})
+	if !ok {
+		return nil, errors.New("csv filters without columns are not supported")
+	}
+	for i, col := range columns {
+		if s, ok := col.(string); ok {
+			columns[i] = ls.FieldPath(s)
+		}
+	}
+
+	// the csv filter ignores events without source field
+	config["ignore_missing"] = true
+	if err := generator.ImportFields(config, "field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("csv", config)}, nil
+}
@@ -2,39 +2,41 @@ package date
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/local/joda"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
 
 type date struct {
-	Field, To     string
-	Formats       []string
-	Locale        string
-	Timezone      string
-	DropField     bool
-	IgnoreFailure bool
+	Field, To string
+	Formats   []string
+	Locale    string
+	Timezone  string
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	To            string `config:"target_field"`
-	Format        string
-	Formats       []string
-	Locale        string
-	Timezone      string
-	DropField     bool `config:"drop_field"`
-	IgnoreFailure bool `config:"ignore_failure"`
+	Field    string `validate:"required"`
+	To       string `config:"target_field"`
+	Format   string
+	Formats  []string
+	Locale   string
+	Timezone string
 }
 
 func init() {
 	generator.Register("date", makeDate)
+	generator.RegisterIngestImport("date", importIngest)
+	generator.RegisterLogstashImport("date", importLogstash)
 }
 
-func makeDate(cfg *common.Config) (generator.Processor, error) {
+func makeDate(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -46,18 +48,26 @@ func makeDate(cfg *common.Config) (generator.Processor, error) {
 	}
 
 	return &date{
-		Field:         config.Field,
-		To:            config.To,
-		Formats:       formats,
-		Locale:        config.Locale,
-		Timezone:      config.Timezone,
-		DropField:     config.DropField,
-		IgnoreFailure: config.IgnoreFailure,
+		Field:    config.Field,
+		To:       config.To,
+		Formats:  formats,
+		Locale:   config.Locale,
+		Timezone: config.Timezone,
 	}, nil
 }
 
 func (d *date) Name() string { return "date" }
 
+func (d *date) SourceField() string { return d.Field }
+
+func (d *date) Flow() (generator.Flow, error) {
+	to := d.To
+	if to == "" {
+		to = "@timestamp"
+	}
+	return generator.Flow{Reads: []string{d.Field}, Writes: []string{to}}, nil
+}
+
 func (d *date) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field":   d.Field,
@@ -72,32 +82,18 @@ func (d *date) CompileIngest() ([]ingest.Processor, error) {
 	if d.Locale != "" {
 		params["locale"] = d.Locale
 	}
-	if d.IgnoreFailure {
-		params["ignore_failure"] = d.IgnoreFailure
-	}
 
-	ps := ingest.MakeSingleProcessor("date", params)
-	if d.DropField {
-		ps = append(ps, ingest.RemoveField(d.Field))
-	}
-	return ps, nil
+	return ingest.MakeSingleProcessor("date", params), nil
 }
 
 func (d *date) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	var failureTag string
-	if !d.IgnoreFailure {
-		failureTag = ctx.CreateTag("_failure_date")
-	}
+	failureTag := ctx.CreateTag("_failure")
 
 	params := ls.Params{
-		"match": append([]string{ls.NormalizeField(d.Field)}, d.Formats...),
+		"match":          append([]string{ls.NormalizeField(d.Field)}, d.Formats...),
+		"tag_on_failure": failureTag,
 	}
-	if failureTag != "" {
-		params["tag_on_failure"] = failureTag
-	}
-
 	params.Target(d.To)
-	params.DropField(d.DropField, d.Field)
 
 	if d.Timezone != "" {
 		params["timezone"] = d.Timezone
@@ -114,6 +110,47 @@ func (d *date) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBloc
 	}, nil
 }
 
+func (d *date) CompileLocal() ([]local.Processor, error) {
+	loc := time.UTC
+	if d.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(d.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, format := range d.Formats {
+		switch format {
+		case "ISO8601", "UNIX", "UNIX_MS", "TAI64N":
+		default:
+			if _, err := joda.ToLayout(format); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	to := d.To
+	if to == "" {
+		to = "@timestamp"
+	}
+
+	parse := func(doc local.Document) error {
+		value, _, err := doc.StringField(d.Field, false)
+		if err != nil {
+			return err
+		}
+
+		for _, format := range d.Formats {
+			if ts, err := joda.Parse(format, value, loc); err == nil {
+				return doc.Put(to, ts.Format(joda.Layout))
+			}
+		}
+		return fmt.Errorf("unable to parse date [%v]", value)
+	}
+
+	return local.Single(parse), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
@@ -125,3 +162,44 @@ func (c *config) Validate() error {
 
 	return nil
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":        "field",
+		"target_field": "target_field",
+		"formats":      "formats",
+		"timezone":     "timezone",
+		"locale":       "locale",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("date", config), nil
+}
+
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"match":          "match",
+		"target":         "target_field",
+		"timezone":       "timezone",
+		"locale":         "locale",
+		"tag_on_failure": "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	match, ok := config["match"].([]interface{})
+	if !ok || len(match) < 2 {
+		return nil, errors.New("match must configure the field and formats")
+	}
+	delete(config, "match")
+
+	config["field"] = match[0]
+	config["formats"] = match[1:]
+	generator.ImportTagOnFailure(config)
+	if err := generator.ImportFields(config, "field", "target_field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("date", config)}, nil
+}
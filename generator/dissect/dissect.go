@@ -0,0 +1,281 @@
+package dissect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	godissect "github.com/urso/bpb/prog/local/dissect"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type dissect struct {
+	config
+	dissector *godissect.Dissector
+}
+
+type config struct {
+	Field           string `validate:"required"`
+	Pattern         string `validate:"required"`
+	AppendSeparator string `config:"append_separator"`
+}
+
+var lsValueRef = regexp.MustCompile(`%\{&([^}]+?)(?:->)?\}`)
+
+func init() {
+	generator.Register("dissect", makeDissect)
+	generator.RegisterIngestImport("dissect", importIngest)
+	generator.RegisterLogstashImport("dissect", importLogstash)
+}
+
+func makeDissect(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	dissector, err := godissect.Parse(config.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// field names are stored as dotted field names and converted to field
+	// references for Logstash only
+	config.Pattern = dissector.Format(fieldNames(ls.FieldPath))
+	if dissector, err = godissect.Parse(config.Pattern); err != nil {
+		return nil, err
+	}
+
+	return &dissect{config: config, dissector: dissector}, nil
+}
+
+// fieldNames creates a key mapping function, applying fn to the names of keys
+// storing values in fields.
+func fieldNames(fn func(string) string) func(godissect.Key) godissect.Key {
+	return func(k godissect.Key) godissect.Key {
+		if k.Modifier == godissect.None || k.Modifier == godissect.Append {
+			k.Name = fn(k.Name)
+		}
+		return k
+	}
+}
+
+func (d *dissect) Name() string { return "dissect" }
+
+func (d *dissect) SourceField() string { return d.Field }
+
+// Flow reports the event root as extended if the pattern uses reference keys,
+// as the field names are read from the event.
+func (d *dissect) Flow() (generator.Flow, error) {
+	flow := generator.Flow{Reads: []string{d.Field}}
+	seen := map[string]bool{}
+	for _, key := range d.dissector.Keys() {
+		switch key.Modifier {
+		case godissect.None, godissect.Append:
+			if !seen[key.Name] {
+				seen[key.Name] = true
+				flow.Writes = append(flow.Writes, key.Name)
+			}
+		case godissect.ValueRef:
+			flow.Extends = []string{""}
+		}
+	}
+	return flow, nil
+}
+
+func (d *dissect) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"field":   d.Field,
+		"pattern": d.Pattern,
+	}
+	if d.AppendSeparator != "" {
+		params["append_separator"] = d.AppendSeparator
+	}
+	return ingest.MakeSingleProcessor("dissect", params), nil
+}
+
+// CompileLogstash converts the pattern to the Logstash syntax. Logstash joins
+// appended values using the delimiters found in the input. Appended values are
+// stored in temporary fields instead, and joined by a ruby filter using the
+// append separator.
+//
+// failure tag: config via `tag_on_failure` (default: `_dissectfailure`)
+func (d *dissect) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	groups := d.dissector.AppendGroups()
+	tmp := ""
+	if len(groups) > 0 {
+		tmp = ls.NormalizeField("@metadata." + ctx.CreateTag("_dissect"))
+	}
+
+	i := -1
+	pattern := d.dissector.Format(func(k godissect.Key) godissect.Key {
+		i++
+		switch k.Modifier {
+		case godissect.None, godissect.Append:
+			if _, isAppend := groups[k.Name]; isAppend {
+				k = godissect.Key{Name: fmt.Sprintf("%v[%v]", tmp, i), Padding: k.Padding}
+			} else {
+				k.Name = ls.NormalizeField(k.Name)
+			}
+		case godissect.NamedRef:
+			// Logstash uses the skip modifier for the field name
+			k.Modifier = godissect.Skip
+		}
+		return k
+	})
+
+	blk := ls.MakeBlock(ls.MakeFilter("dissect", ls.Params{
+		"mapping": ls.Params{
+			ls.NormalizeField(d.Field): pattern,
+		},
+		"tag_on_failure": []string{failureTag},
+	}))
+
+	if len(groups) > 0 {
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var code []string
+		for _, name := range names {
+			refs := make([]string, len(groups[name]))
+			for j, idx := range groups[name] {
+				refs[j] = fmt.Sprintf("'%v[%v]'", tmp, idx)
+			}
+			code = append(code, fmt.Sprintf("event.set('%v', [%v].map { |f| event.get(f) }.join(%v))",
+				ls.NormalizeField(name), strings.Join(refs, ", "), generator.RubyString(d.AppendSeparator)))
+		}
+		code = append(code, fmt.Sprintf("event.remove('%v')", tmp))
+
+		blk = append(blk, ls.Conditional{
+			Cond: []ls.Case{{
+				Cond: ls.Expression(fmt.Sprintf(`"%v" not in [tags]`, failureTag)),
+				Block: ls.MakeBlock(ls.MakeFilter("ruby", ls.Params{
+					"code": strings.Join(code, "; "),
+				})),
+			}},
+		})
+	}
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "dissect", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (d *dissect) CompileLocal() ([]local.Processor, error) {
+	split := func(doc local.Document) error {
+		value, _, err := doc.StringField(d.Field, false)
+		if err != nil {
+			return err
+		}
+
+		fields, err := d.dissector.Dissect(value, d.AppendSeparator)
+		if err == godissect.ErrNoMatch {
+			return fmt.Errorf("Unable to find match for dissect pattern: %v against source: %v", d.Pattern, value)
+		}
+		if err != nil {
+			return err
+		}
+
+		for field, v := range fields {
+			if err := doc.Put(field, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return local.Single(split), nil
+}
+
+func defaultConfig() config {
+	return config{}
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":            "field",
+		"pattern":          "pattern",
+		"append_separator": "append_separator",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("dissect", config), nil
+}
+
+// importLogstash creates a dissect processor per mapping. Patterns with append
+// keys are not imported, as Logstash joins appended values using the
+// delimiters found in the input.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"mapping":        "mapping",
+		"tag_on_failure": "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generator.ImportTagOnFailure(config)
+
+	mapping, ok := config["mapping"].(ls.Params)
+	if !ok {
+		return nil, errors.New("mapping must be a hash")
+	}
+	delete(config, "mapping")
+
+	fields := make([]string, 0, len(mapping))
+	for field := range mapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var configs []map[string]interface{}
+	for _, field := range fields {
+		pattern, ok := mapping[field].(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern for '%v' must be a string", field)
+		}
+
+		dissector, err := godissect.Parse(lsNamedRefs(pattern))
+		if err != nil {
+			return nil, err
+		}
+		if len(dissector.AppendGroups()) > 0 {
+			return nil, errors.New("append keys not supported")
+		}
+
+		processor := map[string]interface{}{
+			"field":   ls.FieldPath(field),
+			"pattern": dissector.Format(fieldNames(ls.FieldPath)),
+		}
+		for k, v := range config {
+			processor[k] = v
+		}
+		configs = append(configs, generator.MakeImport("dissect", processor))
+	}
+	return configs, nil
+}
+
+// lsNamedRefs replaces the Logstash skip keys used as field names by `&` keys
+// with `*` keys.
+func lsNamedRefs(pattern string) string {
+	for _, m := range lsValueRef.FindAllStringSubmatch(pattern, -1) {
+		for _, suffix := range []string{"}", "->}"} {
+			pattern = strings.Replace(pattern, "%{?"+m[1]+suffix, "%{*"+m[1]+suffix, -1)
+		}
+	}
+	return pattern
+}
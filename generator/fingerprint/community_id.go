@@ -0,0 +1,412 @@
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// communityID computes the Community ID flow hash of network events. The
+// protocol is read from the IANA number, or from the transport name if the
+// IANA number is missing. Missing fields are ignored by default, like in
+// Ingest Node.
+type communityID struct {
+	communityIDConfig
+	ignoreMissing bool
+}
+
+type communityIDConfig struct {
+	SourceIP        string `config:"source_ip"`
+	SourcePort      string `config:"source_port"`
+	DestinationIP   string `config:"destination_ip"`
+	DestinationPort string `config:"destination_port"`
+	IANANumber      string `config:"iana_number"`
+	ICMPType        string `config:"icmp_type"`
+	ICMPCode        string `config:"icmp_code"`
+	Transport       string `config:"transport"`
+	To              string `config:"target_field"`
+	Seed            int    `config:"seed" validate:"min=0,max=65535"`
+}
+
+// transports maps the transport names to IANA protocol numbers.
+var transports = map[string]int{
+	"icmp":      1,
+	"igmp":      2,
+	"tcp":       6,
+	"udp":       17,
+	"gre":       47,
+	"ipv6-icmp": 58,
+	"icmpv6":    58,
+	"eigrp":     88,
+	"ospf":      89,
+	"pim":       103,
+	"sctp":      132,
+}
+
+// icmpEquivalents maps ICMP and ICMPv6 message types to the type of the
+// message sent in the opposite direction. Types without equivalent are one
+// way messages, using the ICMP code as destination port.
+var icmpEquivalents = map[int]map[int]int{
+	1: {
+		0: 8, 8: 0,
+		9: 10, 10: 9,
+		13: 14, 14: 13,
+		15: 16, 16: 15,
+		17: 18, 18: 17,
+	},
+	58: {
+		128: 129, 129: 128,
+		130: 131, 131: 130,
+		133: 134, 134: 133,
+		135: 136, 136: 135,
+		139: 140, 140: 139,
+		144: 145, 145: 144,
+	},
+}
+
+func init() {
+	generator.Register("community_id", makeCommunityID)
+	generator.RegisterIngestImport("community_id", importIngestCommunityID)
+}
+
+func makeCommunityID(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultCommunityIDConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	return &communityID{communityIDConfig: config, ignoreMissing: true}, nil
+}
+
+func defaultCommunityIDConfig() communityIDConfig {
+	return communityIDConfig{
+		SourceIP:        "source.ip",
+		SourcePort:      "source.port",
+		DestinationIP:   "destination.ip",
+		DestinationPort: "destination.port",
+		IANANumber:      "network.iana_number",
+		ICMPType:        "icmp.type",
+		ICMPCode:        "icmp.code",
+		Transport:       "network.transport",
+		To:              "network.community_id",
+	}
+}
+
+func (c *communityID) Name() string { return "community_id" }
+
+func (c *communityID) DefaultOptions() generator.Options {
+	return generator.Options{IgnoreMissing: true}
+}
+
+func (c *communityID) WithIgnoreMissing(ignore bool) generator.Processor {
+	return &communityID{communityIDConfig: c.communityIDConfig, ignoreMissing: ignore}
+}
+
+// Flow reports the IP addresses as required if missing fields are not
+// ignored. The other fields are read depending on the protocol.
+func (c *communityID) Flow() (generator.Flow, error) {
+	ips := []string{c.SourceIP, c.DestinationIP}
+	flow := generator.Flow{
+		MayRead: []string{c.SourcePort, c.DestinationPort, c.IANANumber, c.ICMPType, c.ICMPCode, c.Transport},
+	}
+	if c.ignoreMissing {
+		flow.MayRead = append(ips, flow.MayRead...)
+		flow.MayWrite = []string{c.To}
+	} else {
+		flow.Reads = ips
+		flow.Writes = []string{c.To}
+	}
+	return flow, nil
+}
+
+func (c *communityID) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{}
+	defaults := defaultCommunityIDConfig()
+	for _, setting := range []struct {
+		name          string
+		value, global string
+	}{
+		{"source_ip", c.SourceIP, defaults.SourceIP},
+		{"source_port", c.SourcePort, defaults.SourcePort},
+		{"destination_ip", c.DestinationIP, defaults.DestinationIP},
+		{"destination_port", c.DestinationPort, defaults.DestinationPort},
+		{"iana_number", c.IANANumber, defaults.IANANumber},
+		{"icmp_type", c.ICMPType, defaults.ICMPType},
+		{"icmp_code", c.ICMPCode, defaults.ICMPCode},
+		{"transport", c.Transport, defaults.Transport},
+		{"target_field", c.To, defaults.To},
+	} {
+		if setting.value != setting.global {
+			params[setting.name] = setting.value
+		}
+	}
+	if c.Seed != 0 {
+		params["seed"] = c.Seed
+	}
+	if !c.ignoreMissing {
+		params["ignore_missing"] = false
+	}
+	return ingest.MakeSingleProcessor("community_id", params), nil
+}
+
+// failure tag: none, need to generate custom tag handling
+func (c *communityID) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	missing := func(what string) string {
+		if c.ignoreMissing {
+			return "return"
+		}
+		return fmt.Sprintf("raise 'missing %v'", what)
+	}
+	get := func(name, field, what string) string {
+		return fmt.Sprintf("%v = event.get('%v'); %v if %v.nil?", name, ls.NormalizeField(field), missing(what), name)
+	}
+
+	code := []string{
+		`num = lambda { |v, name, min, max| i = (v.is_a?(String) ? Integer(v, 10) : v) rescue nil; i = i.to_i if i.is_a?(Float) && i == i.floor; ` +
+			`raise 'invalid ' + name + ' [' + v.to_s + ']' unless i.is_a?(Integer) && i >= min && i <= max; i }`,
+		`ip = lambda { |v, name| a = IPAddr.new(v.to_s) rescue raise('invalid ' + name + ' [' + v.to_s + ']'); a = a.native if a.ipv4_mapped?; a.hton }`,
+		get("sip", c.SourceIP, "source ip address"),
+		get("dip", c.DestinationIP, "destination ip address"),
+		fmt.Sprintf("proto = event.get('%v'); proto = event.get('%v') if proto.nil?", ls.NormalizeField(c.IANANumber), ls.NormalizeField(c.Transport)),
+		fmt.Sprintf("%v if proto.nil?", missing("transport protocol")),
+		fmt.Sprintf("proto = %v[proto.to_s.downcase] || num.call(proto, 'transport protocol', 0, 255)", rubyTransports()),
+		"sp = nil; dp = nil; ow = false",
+		"if [6, 17, 132].include?(proto)",
+		get("sp", c.SourcePort, "source port"),
+		get("dp", c.DestinationPort, "destination port"),
+		"sp = num.call(sp, 'source port', 1, 65535); dp = num.call(dp, 'destination port', 1, 65535)",
+		"elsif proto == 1 || proto == 58",
+		get("sp", c.ICMPType, "icmp type"),
+		fmt.Sprintf("sp = num.call(sp, 'icmp type', 0, 255); dp = (proto == 1 ? %v : %v)[sp]",
+			rubyHash(icmpEquivalents[1]), rubyHash(icmpEquivalents[58])),
+		"if dp.nil?; ow = true",
+		get("dp", c.ICMPCode, "icmp code"),
+		"dp = num.call(dp, 'icmp code', 0, 255); end",
+		"end",
+		"s = ip.call(sip, 'source ip address'); d = ip.call(dip, 'destination ip address')",
+		"if !ow && ((s <=> d) > 0 || (s == d && sp && sp > dp)); s, d, sp, dp = d, s, dp, sp; end",
+		fmt.Sprintf("b = [%v].pack('n') + s + d + [proto, 0].pack('CC'); b += [sp, dp].pack('nn') if sp", c.Seed),
+		fmt.Sprintf("event.set('%v', '1:' + [Digest::SHA1.digest(b)].pack('m0'))", ls.NormalizeField(c.To)),
+	}
+
+	blk := generator.MakeRuby(ctx, strings.Join(code, "; "), failureTag, ls.Params{"init": "require 'digest'; require 'ipaddr'"})
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "community_id", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func rubyTransports() string {
+	var entries []string
+	for name, proto := range transports {
+		entries = append(entries, fmt.Sprintf("'%v' => %v", name, proto))
+	}
+	sort.Strings(entries)
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func rubyHash(m map[int]int) string {
+	var entries []string
+	for k, v := range m {
+		entries = append(entries, fmt.Sprintf("%v => %v", k, v))
+	}
+	sort.Strings(entries)
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+func (c *communityID) CompileLocal() ([]local.Processor, error) {
+	hash := func(doc local.Document) error {
+		id, err := c.hash(doc)
+		if err != nil || id == "" {
+			return err
+		}
+		return doc.Put(c.To, id)
+	}
+
+	return local.Single(hash), nil
+}
+
+// hash computes the community ID. An empty string is returned if fields are
+// missing and ignore_missing is set.
+func (c *communityID) hash(doc local.Document) (string, error) {
+	var missing bool
+	get := func(field, what string) (interface{}, error) {
+		v, _ := doc.Get(field)
+		if v == nil {
+			if !c.ignoreMissing {
+				return nil, fmt.Errorf("missing %v", what)
+			}
+			missing = true
+		}
+		return v, nil
+	}
+
+	sip, err := get(c.SourceIP, "source ip address")
+	if err != nil || missing {
+		return "", err
+	}
+	dip, err := get(c.DestinationIP, "destination ip address")
+	if err != nil || missing {
+		return "", err
+	}
+
+	proto, _ := doc.Get(c.IANANumber)
+	if proto == nil {
+		if proto, err = get(c.Transport, "transport protocol"); err != nil || missing {
+			return "", err
+		}
+	}
+	p, known := transports[strings.ToLower(fmt.Sprint(proto))]
+	if !known {
+		if p, err = toNumber(proto, "transport protocol", 0, 255); err != nil {
+			return "", err
+		}
+	}
+
+	var ports []int
+	oneWay := false
+	switch p {
+	case 6, 17, 132:
+		sp, err := get(c.SourcePort, "source port")
+		if err != nil || missing {
+			return "", err
+		}
+		dp, err := get(c.DestinationPort, "destination port")
+		if err != nil || missing {
+			return "", err
+		}
+
+		src, err := toNumber(sp, "source port", 1, 65535)
+		if err != nil {
+			return "", err
+		}
+		dst, err := toNumber(dp, "destination port", 1, 65535)
+		if err != nil {
+			return "", err
+		}
+		ports = []int{src, dst}
+
+	case 1, 58:
+		t, err := get(c.ICMPType, "icmp type")
+		if err != nil || missing {
+			return "", err
+		}
+		typ, err := toNumber(t, "icmp type", 0, 255)
+		if err != nil {
+			return "", err
+		}
+
+		equiv, exists := icmpEquivalents[p][typ]
+		if !exists {
+			oneWay = true
+			code, err := get(c.ICMPCode, "icmp code")
+			if err != nil || missing {
+				return "", err
+			}
+			if equiv, err = toNumber(code, "icmp code", 0, 255); err != nil {
+				return "", err
+			}
+		}
+		ports = []int{typ, equiv}
+	}
+
+	src, err := parseIP(sip, "source ip address")
+	if err != nil {
+		return "", err
+	}
+	dst, err := parseIP(dip, "destination ip address")
+	if err != nil {
+		return "", err
+	}
+
+	if cmp := bytes.Compare(src, dst); !oneWay && (cmp > 0 || cmp == 0 && ports != nil && ports[0] > ports[1]) {
+		src, dst = dst, src
+		if ports != nil {
+			ports[0], ports[1] = ports[1], ports[0]
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(c.Seed))
+	buf.Write(src)
+	buf.Write(dst)
+	buf.Write([]byte{byte(p), 0})
+	for _, port := range ports {
+		binary.Write(&buf, binary.BigEndian, uint16(port))
+	}
+
+	digest := sha1.Sum(buf.Bytes())
+	return "1:" + base64.StdEncoding.EncodeToString(digest[:]), nil
+}
+
+// toNumber converts numbers and numeric strings to integers within the range
+// [min, max].
+func toNumber(v interface{}, what string, min, max int) (int, error) {
+	i, ok := 0, false
+	switch v := v.(type) {
+	case int:
+		i, ok = v, true
+	case int64:
+		i, ok = int(v), true
+	case float64:
+		i, ok = int(v), v == math.Trunc(v)
+	case string:
+		n, err := strconv.Atoi(v)
+		i, ok = n, err == nil
+	}
+	if !ok || i < min || i > max {
+		return 0, fmt.Errorf("invalid %v [%v]", what, v)
+	}
+	return i, nil
+}
+
+// parseIP returns the 4 byte representation of IPv4 addresses, including
+// IPv4-mapped IPv6 addresses, and the 16 byte representation of IPv6
+// addresses.
+func parseIP(v interface{}, what string) ([]byte, error) {
+	s, _ := v.(string)
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %v [%v]", what, v)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4, nil
+	}
+	return ip, nil
+}
+
+func importIngestCommunityID(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source_ip":        "source_ip",
+		"source_port":      "source_port",
+		"destination_ip":   "destination_ip",
+		"destination_port": "destination_port",
+		"iana_number":      "iana_number",
+		"icmp_type":        "icmp_type",
+		"icmp_code":        "icmp_code",
+		"transport":        "transport",
+		"target_field":     "target_field",
+		"seed":             "seed",
+		"ignore_missing":   "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("community_id", config), nil
+}
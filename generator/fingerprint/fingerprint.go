@@ -0,0 +1,305 @@
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// fingerprint hashes the values of multiple fields into the base64 encoded
+// target field. The Logstash fingerprint filter serializes fields differently
+// than Ingest Node, a ruby filter implementing the Ingest Node serialization
+// is generated instead.
+//
+// Fields are hashed in sorted order, starting with the salt. Each value is
+// prefixed with a 0 byte. Lists are hashed element by element and objects
+// by sorted keys, each key followed by its value. Numbers are hashed in
+// little endian byte order, as 4 byte integer if they fit, as 8 byte
+// integer or double otherwise. The local runner can not distinguish integral
+// floating point numbers from integers, such that these are hashed as
+// integers. Like in Ingest Node, the target field is not set if all fields are
+// missing.
+type fingerprint struct {
+	config
+	ignoreMissing bool
+}
+
+type config struct {
+	Fields []string `validate:"required"`
+	Method string
+	Salt   string
+	To     string `config:"target_field"`
+}
+
+type method struct {
+	// ingest is the method name used by the Ingest Node fingerprint processor
+	ingest string
+
+	// ruby computes the digest of the byte string `b`, using the helpers
+	// defined by rubyDefs
+	ruby, rubyDefs string
+
+	fn func([]byte) []byte
+}
+
+var methods = map[string]method{
+	"md5": {ingest: "MD5", ruby: "Digest::MD5.digest(b)", fn: func(b []byte) []byte {
+		d := md5.Sum(b)
+		return d[:]
+	}},
+	"sha1": {ingest: "SHA-1", ruby: "Digest::SHA1.digest(b)", fn: func(b []byte) []byte {
+		d := sha1.Sum(b)
+		return d[:]
+	}},
+	"sha256": {ingest: "SHA-256", ruby: "Digest::SHA256.digest(b)", fn: func(b []byte) []byte {
+		d := sha256.Sum256(b)
+		return d[:]
+	}},
+	"sha512": {ingest: "SHA-512", ruby: "Digest::SHA512.digest(b)", fn: func(b []byte) []byte {
+		d := sha512.Sum512(b)
+		return d[:]
+	}},
+	"murmur3": {ingest: "MurmurHash3", ruby: "mm3.call(b)", rubyDefs: rubyMurmur3, fn: murmur3},
+}
+
+// rubySerialize defines the lambda `w` appending values to the byte string
+// `b`.
+const rubySerialize = `w = lambda { |v| case v ` +
+	`when Array then v.each { |e| w.call(e) }; ` +
+	`when Hash then v.keys.sort_by(&:to_s).each { |k| b << 0.chr << k.to_s.b; w.call(v[k]) }; ` +
+	`when String then b << 0.chr << v.b; ` +
+	`when true then b << 0.chr << 1.chr; ` +
+	`when false then b << 0.chr << 2.chr; ` +
+	`when Integer then b << 0.chr << (v >= -2**31 && v < 2**31 ? [v].pack('l<') : [v].pack('q<')); ` +
+	`when Float then b << 0.chr << [v].pack('E'); ` +
+	`when nil then b << 0.chr; ` +
+	`else raise 'cannot convert object of type [' + v.class.to_s + '] to bytes'; end }`
+
+func init() {
+	generator.Register("fingerprint", makeFingerprint)
+	generator.RegisterIngestImport("fingerprint", importIngestFingerprint)
+}
+
+func makeFingerprint(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	if _, exists := methods[config.Method]; !exists {
+		return nil, fmt.Errorf("unknown fingerprint method '%v'", config.Method)
+	}
+
+	config.Fields = append([]string(nil), config.Fields...)
+	sort.Strings(config.Fields)
+	return &fingerprint{config: config}, nil
+}
+
+func defaultConfig() config {
+	return config{Method: "sha1", To: "fingerprint"}
+}
+
+func (f *fingerprint) Name() string { return "fingerprint" }
+
+func (f *fingerprint) WithIgnoreMissing(ignore bool) generator.Processor {
+	return &fingerprint{config: f.config, ignoreMissing: ignore}
+}
+
+func (f *fingerprint) Flow() (generator.Flow, error) {
+	if f.ignoreMissing {
+		return generator.Flow{MayRead: f.Fields, MayWrite: []string{f.To}}, nil
+	}
+	return generator.Flow{Reads: f.Fields, Writes: []string{f.To}}, nil
+}
+
+func (f *fingerprint) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"fields":       f.Fields,
+		"target_field": f.To,
+		"method":       methods[f.Method].ingest,
+	}
+	if f.Salt != "" {
+		params["salt"] = f.Salt
+	}
+	if f.ignoreMissing {
+		params["ignore_missing"] = true
+	}
+	return ingest.MakeSingleProcessor("fingerprint", params), nil
+}
+
+// failure tag: none, need to generate custom tag handling
+func (f *fingerprint) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	fields := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		fields[i] = fmt.Sprintf("['%v', '%v']", field, ls.NormalizeField(field))
+	}
+
+	missing := "raise 'missing field [' + f + '] when calculating fingerprint'"
+	if f.ignoreMissing {
+		missing = "next"
+	}
+
+	m := methods[f.Method]
+	code := []string{
+		fmt.Sprintf("b = %v", rubyBytes(f.Salt)),
+		"found = false",
+		rubySerialize,
+		fmt.Sprintf("[%v].each { |f, ref| v = event.get(ref); if v.nil?; %v; end; found = true; w.call(v) }", strings.Join(fields, ", "), missing),
+	}
+	if m.rubyDefs != "" {
+		code = append(code, m.rubyDefs)
+	}
+	code = append(code, fmt.Sprintf("event.set('%v', [%v].pack('m0')) if found", ls.NormalizeField(f.To), m.ruby))
+
+	blk := generator.MakeRuby(ctx, strings.Join(code, "; "), failureTag, ls.Params{"init": "require 'digest'"})
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "fingerprint", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+// rubyBytes creates a binary ruby string from s. The bytes are listed
+// explicitly, so s needs no quoting.
+func rubyBytes(s string) string {
+	if s == "" {
+		return "''.b"
+	}
+
+	codes := make([]string, len(s))
+	for i := 0; i < len(s); i++ {
+		codes[i] = fmt.Sprint(s[i])
+	}
+	return fmt.Sprintf("[%v].pack('C*')", strings.Join(codes, ", "))
+}
+
+func (f *fingerprint) CompileLocal() ([]local.Processor, error) {
+	hash := func(doc local.Document) error {
+		buf := bytes.NewBufferString(f.Salt)
+		found := false
+		for _, field := range f.Fields {
+			v, _ := doc.Get(field)
+			if v == nil {
+				if f.ignoreMissing {
+					continue
+				}
+				return fmt.Errorf("missing field [%v] when calculating fingerprint", field)
+			}
+			found = true
+			if err := serialize(buf, v); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		digest := methods[f.Method].fn(buf.Bytes())
+		return doc.Put(f.To, base64.StdEncoding.EncodeToString(digest))
+	}
+
+	return local.Single(hash), nil
+}
+
+func serialize(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			if err := serialize(buf, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteByte(0)
+			buf.WriteString(k)
+			if err := serialize(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	buf.WriteByte(0)
+	switch v := v.(type) {
+	case nil:
+	case string:
+		buf.WriteString(v)
+	case bool:
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(2)
+		}
+	case int:
+		serializeInt(buf, int64(v))
+	case int64:
+		serializeInt(buf, v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			serializeInt(buf, int64(v))
+		} else {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	default:
+		return fmt.Errorf("cannot convert object of type [%T] to bytes", v)
+	}
+	return nil
+}
+
+func serializeInt(buf *bytes.Buffer, i int64) {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		binary.Write(buf, binary.LittleEndian, int32(i))
+	} else {
+		binary.Write(buf, binary.LittleEndian, i)
+	}
+}
+
+func importIngestFingerprint(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"fields":         "fields",
+		"target_field":   "target_field",
+		"method":         "method",
+		"salt":           "salt",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if m, exists := config["method"]; exists {
+		name := ""
+		for k, method := range methods {
+			if method.ingest == m {
+				name = k
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("unknown fingerprint method '%v'", m)
+		}
+		config["method"] = name
+	}
+	return generator.MakeImport("fingerprint", config), nil
+}
@@ -0,0 +1,94 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// murmur3 computes the 128 bit x64 variant of MurmurHash3 with seed 0. Like
+// in Elasticsearch, the two halves of the hash are stored in big endian
+// order.
+func murmur3(data []byte) []byte {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+
+	var h1, h2 uint64
+	n := len(data)
+	for i := 0; i+16 <= n; i += 16 {
+		k1 := binary.LittleEndian.Uint64(data[i:])
+		k2 := binary.LittleEndian.Uint64(data[i+8:])
+
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var tail [16]byte
+	rest := n % 16
+	copy(tail[:], data[n-rest:])
+	k1 := binary.LittleEndian.Uint64(tail[:])
+	k2 := binary.LittleEndian.Uint64(tail[8:])
+	if rest > 8 {
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+	}
+	if rest > 0 {
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+	h2 += h1
+
+	digest := make([]byte, 16)
+	binary.BigEndian.PutUint64(digest, h1)
+	binary.BigEndian.PutUint64(digest[8:], h2)
+	return digest
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// rubyMurmur3 defines the ruby lambda `mm3` implementing murmur3.
+const rubyMurmur3 = `m = 0xffffffffffffffff; ` +
+	`rotl = lambda { |x, r| ((x << r) | (x >> (64 - r))) & m }; ` +
+	`fmix = lambda { |k| k ^= k >> 33; k = (k * 0xff51afd7ed558ccd) & m; k ^= k >> 33; k = (k * 0xc4ceb9fe1a85ec53) & m; k ^ (k >> 33) }; ` +
+	`mm3 = lambda { |s| c1 = 0x87c37b91114253d5; c2 = 0x4cf5ad432745937f; h1 = 0; h2 = 0; n = s.bytesize; ` +
+	`(n / 16).times { |i| k1, k2 = s.byteslice(i * 16, 16).unpack('Q<Q<'); ` +
+	`k1 = (rotl.call((k1 * c1) & m, 31) * c2) & m; h1 ^= k1; h1 = rotl.call(h1, 27); h1 = (h1 + h2) & m; h1 = (h1 * 5 + 0x52dce729) & m; ` +
+	`k2 = (rotl.call((k2 * c2) & m, 33) * c1) & m; h2 ^= k2; h2 = rotl.call(h2, 31); h2 = (h2 + h1) & m; h2 = (h2 * 5 + 0x38495ab5) & m }; ` +
+	`rest = n % 16; k1, k2 = (s.byteslice(n - rest, rest) + (0.chr * (16 - rest))).unpack('Q<Q<'); ` +
+	`h2 ^= (rotl.call((k2 * c2) & m, 33) * c1) & m if rest > 8; ` +
+	`h1 ^= (rotl.call((k1 * c1) & m, 31) * c2) & m if rest > 0; ` +
+	`h1 ^= n; h2 ^= n; h1 = (h1 + h2) & m; h2 = (h2 + h1) & m; h1 = fmix.call(h1); h2 = fmix.call(h2); h1 = (h1 + h2) & m; h2 = (h2 + h1) & m; ` +
+	`[h1, h2].pack('Q>Q>') }`
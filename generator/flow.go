@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Flow describes the fields read and written by a processor. It is used for
+// the static analysis of pipelines.
+type Flow struct {
+	// Reads lists the fields required by the processor.
+	Reads []string
+
+	// MayRead lists the fields read if present.
+	MayRead []string
+
+	// Writes lists the fields set by the processor if it succeeds.
+	Writes []string
+
+	// MayWrite lists the fields set depending on the contents of the event.
+	MayWrite []string
+
+	// Extends lists the objects the processor adds fields with names unknown
+	// in advance to. The empty name denotes the event root.
+	Extends []string
+
+	// Removes lists the fields removed by the processor.
+	Removes []string
+}
+
+// FlowProcessor is implemented by processors reporting the fields they read
+// and write. Processors not implementing FlowProcessor, like scripts, are
+// assumed to read and write any field.
+type FlowProcessor interface {
+	Flow() (Flow, error)
+}
+
+// Branch is a named list of processors run in order.
+type Branch struct {
+	Name       string
+	Processors []Processor
+}
+
+// GroupProcessor is implemented by processors running nested processors.
+// Only one of the branches is run for an event.
+type GroupProcessor interface {
+	Branches() []Branch
+}
+
+// Issue is reported by Lint.
+type Issue struct {
+	// Path is the processor index. Nested processors are addressed by the
+	// index of the enclosing processor, the branch name and their index, like
+	// `3.processors.1`.
+	Path    string
+	Tag     string
+	Message string
+}
+
+// flowState tracks the fields present in the event after each processor.
+type flowState struct {
+	// fields maps present fields to true if they are present in all events
+	fields map[string]bool
+
+	// unread maps written fields not read yet to the processor writing them
+	unread map[string]string
+
+	// opaque is set after processors reading and writing arbitrary fields
+	opaque bool
+}
+
+type linter struct {
+	issues []Issue
+}
+
+type flowScope struct {
+	path, tag string
+
+	// definite is false if the processor is not run for all events
+	definite bool
+}
+
+// Lint checks the flow of fields through the pipeline. It reports processors
+// reading or removing fields no previous processor writes, and fields being
+// overwritten before they are read. The input fields are assumed to be
+// present in all events.
+func (g *Generator) Lint(input []string) []Issue {
+	st := &flowState{fields: map[string]bool{}, unread: map[string]string{}}
+	for _, name := range input {
+		st.fields[name] = true
+	}
+
+	l := &linter{}
+	l.walk(st, g.Processors, "", true)
+	l.walk(st.clone(), g.OnFailure, "on_failure", false)
+	return l.issues
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("processor %v (%v): %v", i.Path, i.Tag, i.Message)
+}
+
+func (l *linter) walk(st *flowState, ps []Processor, prefix string, definite bool) {
+	for i, p := range ps {
+		path := fmt.Sprint(i)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		l.step(st, p, flowScope{path: path, tag: p.Name(), definite: definite})
+	}
+}
+
+func (l *linter) step(st *flowState, p Processor, sc flowScope) {
+	switch v := p.(type) {
+	case *annotated:
+		sc.tag = v.tag
+		l.step(st, v.Processor, sc)
+
+	case *conditional:
+		for _, name := range v.cond.Fields() {
+			st.read(name)
+		}
+		sc.definite = false
+		l.step(st, v.Processor, sc)
+
+	case *fieldGuard:
+		st.read(v.field)
+		sc.definite = false
+		l.step(st, v.Processor, sc)
+
+	case *fieldDrop:
+		// the field is read by the processor, such that missing fields are
+		// reported already
+		l.step(st, v.Processor, sc)
+		st.remove(v.field, sc.definite)
+
+	case *tryCatch:
+		sc.definite = false
+		l.step(st, v.Processor, sc)
+		l.walk(st, v.onFailure, sc.path+".on_failure", false)
+
+	case GroupProcessor:
+		var states []*flowState
+		for _, b := range v.Branches() {
+			branch := st.clone()
+			l.walk(branch, b.Processors, sc.path+"."+b.Name, sc.definite)
+			states = append(states, branch)
+		}
+		if len(states) > 0 {
+			*st = *mergeFlowStates(states)
+		}
+
+	case FlowProcessor:
+		flow, err := v.Flow()
+		if err != nil {
+			l.report(sc, "%v", err)
+			return
+		}
+		l.apply(st, sc, flow)
+
+	default:
+		st.opaque = true
+		st.unread = map[string]string{}
+	}
+}
+
+func (l *linter) apply(st *flowState, sc flowScope, flow Flow) {
+	for _, name := range flow.Reads {
+		if !st.has(name) {
+			l.report(sc, "field '%v' is read, but not written by any previous processor", name)
+		}
+		st.read(name)
+	}
+	for _, name := range flow.MayRead {
+		st.read(name)
+	}
+
+	writer := fmt.Sprintf("processor %v (%v)", sc.path, sc.tag)
+	for _, name := range flow.Writes {
+		if sc.definite {
+			for _, overwritten := range st.overwritten(name) {
+				l.report(sc, "field '%v' written by %v is overwritten before being read",
+					overwritten, st.unread[overwritten])
+			}
+		}
+		st.write(name, writer, sc.definite)
+	}
+	for _, name := range flow.MayWrite {
+		st.write(name, writer, false)
+	}
+	for _, name := range flow.Extends {
+		if _, exists := st.fields[name]; !exists {
+			st.fields[name] = false
+		}
+	}
+
+	for _, name := range flow.Removes {
+		if !contains(flow.Reads, name) && !st.has(name) {
+			l.report(sc, "field '%v' is removed, but not written by any previous processor", name)
+		}
+		st.remove(name, sc.definite)
+	}
+}
+
+func (l *linter) report(sc flowScope, format string, args ...interface{}) {
+	l.issues = append(l.issues, Issue{
+		Path:    sc.path,
+		Tag:     sc.tag,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// has checks if the field or a parent or child field might be present.
+func (st *flowState) has(name string) bool {
+	if st.opaque {
+		return true
+	}
+	for field := range st.fields {
+		if isFieldPrefix(field, name) || isFieldPrefix(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *flowState) read(name string) {
+	for field := range st.unread {
+		if isFieldPrefix(field, name) || isFieldPrefix(name, field) {
+			delete(st.unread, field)
+		}
+	}
+}
+
+// overwritten returns the unread fields replaced by writing to name.
+func (st *flowState) overwritten(name string) []string {
+	var fields []string
+	for field := range st.unread {
+		if isFieldPrefix(name, field) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (st *flowState) write(name, writer string, definite bool) {
+	for _, field := range st.overwritten(name) {
+		delete(st.unread, field)
+	}
+	st.fields[name] = st.fields[name] || definite
+	st.unread[name] = writer
+}
+
+func (st *flowState) remove(name string, definite bool) {
+	for field := range st.fields {
+		if !isFieldPrefix(name, field) {
+			continue
+		}
+		if definite {
+			delete(st.fields, field)
+		} else {
+			st.fields[field] = false
+		}
+	}
+	for field := range st.unread {
+		if isFieldPrefix(name, field) {
+			delete(st.unread, field)
+		}
+	}
+}
+
+func (st *flowState) clone() *flowState {
+	c := &flowState{
+		fields: make(map[string]bool, len(st.fields)),
+		unread: make(map[string]string, len(st.unread)),
+		opaque: st.opaque,
+	}
+	for k, v := range st.fields {
+		c.fields[k] = v
+	}
+	for k, v := range st.unread {
+		c.unread[k] = v
+	}
+	return c
+}
+
+// mergeFlowStates combines the states of alternative branches. Fields are
+// present in all events only if all branches produce them.
+func mergeFlowStates(states []*flowState) *flowState {
+	merged := &flowState{fields: map[string]bool{}, unread: map[string]string{}}
+	for _, st := range states {
+		merged.opaque = merged.opaque || st.opaque
+		for k := range st.fields {
+			definite := true
+			for _, other := range states {
+				definite = definite && other.fields[k]
+			}
+			merged.fields[k] = definite
+		}
+		for k, v := range st.unread {
+			merged.unread[k] = v
+		}
+	}
+	return merged
+}
+
+// isFieldPrefix checks if field is equal to prefix or nested in prefix. The
+// empty prefix denotes the event root.
+func isFieldPrefix(prefix, field string) bool {
+	return prefix == "" || prefix == field || strings.HasPrefix(field, prefix+".")
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
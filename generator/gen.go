@@ -2,9 +2,13 @@ package generator
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strconv"
 
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -14,25 +18,78 @@ type Generator struct {
 	ID          string
 	Description string
 	Processors  []Processor
+
+	// OnFailure processors are executed if a processor fails. If not set,
+	// the error message is stored in `error.message`.
+	OnFailure []Processor
+}
+
+// Settings are pipeline wide settings.
+type Settings struct {
+	// Dir is the directory relative file names are resolved against.
+	Dir string
+
+	// Patterns lists the grok pattern files imported by the pipeline.
+	Patterns []string
+}
+
+// LoadCtx is passed to the processor factories while the pipeline is loaded.
+type LoadCtx struct {
+	Settings Settings
+
+	// path of the processor being loaded, used to derive the default tag
+	path string
 }
 
 type Processor interface {
 	Name() string
 	CompileIngest() ([]ingest.Processor, error)
 	CompileLogstash(ctx *LogstashCtx) (FilterBlock, error)
+	CompileLocal() ([]local.Processor, error)
 }
 
-func New(descr string, processors []*common.Config) (*Generator, error) {
+func New(s Settings, descr string, processors, onFailure []*common.Config) (*Generator, error) {
 	if len(processors) == 0 {
 		return nil, errors.New("no processors")
 	}
 
-	ps, err := LoadAll(processors)
+	ctx := &LoadCtx{Settings: s}
+	ps, err := LoadAll(ctx, processors)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Generator{Description: descr, Processors: ps}, nil
+	handlers, err := LoadAll(ctx.Sub("on_failure"), onFailure)
+	if err != nil {
+		return nil, fmt.Errorf("on_failure: %v", err)
+	}
+
+	return &Generator{Description: descr, Processors: ps, OnFailure: handlers}, nil
+}
+
+// Sub returns the context for a named list of processors nested in the
+// processor being loaded.
+func (ctx *LoadCtx) Sub(name string) *LoadCtx {
+	sub := *ctx
+	sub.path = name
+	if ctx.path != "" {
+		sub.path = ctx.path + "_" + name
+	}
+	return &sub
+}
+
+// at returns the context for the processor at index i of a processor list.
+func (ctx *LoadCtx) at(i int) *LoadCtx {
+	return ctx.Sub(strconv.Itoa(i))
+}
+
+// ResolvePath resolves a file name relative to the directory of the pipeline
+// being loaded.
+func (ctx *LoadCtx) ResolvePath(path string) string {
+	if ctx.Settings.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ctx.Settings.Dir, path)
 }
 
 func (g *Generator) MakeIngest(out io.Writer) error {
@@ -73,6 +130,10 @@ func (g *Generator) CompileIngest() (ingest.Pipeline, error) {
 	}
 
 	pipeline.Processors = processors
+	pipeline.OnFailure, err = CompileIngestProcessors(g.OnFailure)
+	if err != nil {
+		return pipeline, fmt.Errorf("on_failure: %v", err)
+	}
 	if len(pipeline.OnFailure) == 0 {
 		pipeline.OnFailure = ingest.MakeSingleProcessor("set", map[string]interface{}{
 			"field": "error.message",
@@ -88,6 +149,14 @@ func (g *Generator) CompileLogstash(ctx *LogstashCtx) (ls.Pipeline, error) {
 		Description: g.Description,
 	}
 
+	// failing processors tag the event, such that the on_failure
+	// processors are run once at the end of the pipeline. The tag is reset
+	// on return, such that the ctx can be reused.
+	if len(g.OnFailure) > 0 {
+		ctx.failureTag = ctx.CreateTag("_failure_pipeline")
+		defer func() { ctx.failureTag = "" }()
+	}
+
 	onError := MakeLSErrorReporter(ctx)
 	processors, err := CompileLogstashProcessors(ctx, onError, g.Processors)
 	if err != nil {
@@ -95,6 +164,55 @@ func (g *Generator) CompileLogstash(ctx *LogstashCtx) (ls.Pipeline, error) {
 	}
 
 	pipeline.Block = processors.Block
+	if ctx.failureTag == "" || ctx.DisableErrors {
+		return pipeline, nil
+	}
+
+	// errors in on_failure processors are reported in error.message
+	failureTag := ctx.failureTag
+	ctx.failureTag = ""
+	handlers, err := CompileLogstashProcessors(ctx, MakeLSErrorReporter(ctx), g.OnFailure)
+	if err != nil {
+		return pipeline, fmt.Errorf("on_failure: %v", err)
+	}
+
+	params := ls.Params{}
+	params.RemoveTag(failureTag)
+	blk := append(ls.MakeBlock(ls.MakeFilter("mutate", params)), handlers.Block...)
+	setLSFilterIDs(ctx, blk, "on_failure")
+	pipeline.Block = append(pipeline.Block, ls.Conditional{
+		Cond: []ls.Case{
+			{
+				Cond:  ls.Expression(fmt.Sprintf(`"%v" in [tags]`, failureTag)),
+				Block: blk,
+			},
+		},
+	})
+	return pipeline, nil
+}
+
+func (g *Generator) CompileLocal() (local.Pipeline, error) {
+	pipeline := local.Pipeline{
+		Description: g.Description,
+	}
+
+	processors, err := CompileLocalProcessors(g.Processors)
+	if err != nil {
+		return pipeline, err
+	}
+
+	pipeline.Processors = processors
+	if len(g.OnFailure) == 0 {
+		pipeline.OnFailure = local.Single(func(doc local.Document) error {
+			return doc.Put("error.message", doc.FailureMessage())
+		})
+		return pipeline, nil
+	}
+
+	pipeline.OnFailure, err = CompileLocalProcessors(g.OnFailure)
+	if err != nil {
+		return pipeline, fmt.Errorf("on_failure: %v", err)
+	}
 	return pipeline, nil
 }
 
@@ -115,3 +233,21 @@ func CompileIngestProcessors(input []Processor) ([]ingest.Processor, error) {
 
 	return processors, nil
 }
+
+func CompileLocalProcessors(input []Processor) ([]local.Processor, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	var processors []local.Processor
+	for _, gen := range input {
+		ps, err := gen.CompileLocal()
+		if err != nil {
+			return nil, err
+		}
+
+		processors = append(processors, ps...)
+	}
+
+	return processors, nil
+}
@@ -1,8 +1,11 @@
 package geoip
 
 import (
+	"errors"
+
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -13,16 +16,17 @@ type geoip struct {
 }
 
 type config struct {
-	Field     string `validate:"required"`
-	To        string `config:"target_field"`
-	DropField bool   `config:"drop_field"`
+	Field string `validate:"required"`
+	To    string `config:"target_field"`
 }
 
 func init() {
 	generator.Register("geoip", makeGeoip)
+	generator.RegisterIngestImport("geoip", importIngest)
+	generator.RegisterLogstashImport("geoip", importLogstash)
 }
 
-func makeGeoip(cfg *common.Config) (generator.Processor, error) {
+func makeGeoip(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -33,6 +37,16 @@ func makeGeoip(cfg *common.Config) (generator.Processor, error) {
 
 func (g *geoip) Name() string { return "geoip" }
 
+func (g *geoip) SourceField() string { return g.Field }
+
+func (g *geoip) Flow() (generator.Flow, error) {
+	to := g.To
+	if to == "" {
+		to = "geoip"
+	}
+	return generator.Flow{Reads: []string{g.Field}, Writes: []string{to}}, nil
+}
+
 func (u *geoip) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field": u.Field,
@@ -41,23 +55,18 @@ func (u *geoip) CompileIngest() ([]ingest.Processor, error) {
 		params["target_field"] = u.To
 	}
 
-	ps := ingest.MakeSingleProcessor("geoip", params)
-	if u.DropField {
-		ps = append(ps, ingest.RemoveField(u.Field))
-	}
-	return ps, nil
+	return ingest.MakeSingleProcessor("geoip", params), nil
 }
 
 // failure tag: config via `tag_on_failure` (default: `_geoip_lookup_failure`)
 func (g *geoip) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	failureTag := ctx.CreateTag("_failure_geoip")
+	failureTag := ctx.CreateTag("_failure")
 
 	params := ls.Params{
 		"source":         ls.NormalizeField(g.Field),
 		"tag_on_failure": failureTag,
 	}
 	params.Target(g.To)
-	params.DropField(g.DropField, g.Field)
 	return generator.FilterBlock{
 		Block: ls.MakeVerboseBlock(ctx.Verbose, "geoip",
 			ls.MakeFilter("geoip", params),
@@ -66,6 +75,38 @@ func (g *geoip) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlo
 	}, nil
 }
 
+func (g *geoip) CompileLocal() ([]local.Processor, error) {
+	return nil, errors.New("geoip not supported on 'local' target")
+}
+
 func defaultConfig() config {
 	return config{}
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":        "field",
+		"target_field": "target_field",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("geoip", config), nil
+}
+
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source":         "field",
+		"target":         "target_field",
+		"tag_on_failure": "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generator.ImportTagOnFailure(config)
+	if err := generator.ImportFields(config, "field", "target_field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("geoip", config)}, nil
+}
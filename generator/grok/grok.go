@@ -2,36 +2,64 @@ package grok
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	gogrok "github.com/urso/bpb/prog/local/grok"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
 
 type grok struct {
-	Field         string
-	Patterns      []string
-	Definitions   map[string]string
-	IgnoreMissing bool
-	DropField     bool
+	Field       string
+	Patterns    []string
+	Definitions map[string]string
+
+	// captures of each pattern. The patterns are only compiled by the local
+	// runner, such that patterns not supported by go regexp can be used with
+	// Ingest Node and Logstash.
+	captures [][]gogrok.Capture
 }
 
 type config struct {
 	Field         string `validate:"required"`
 	Pattern       string
 	Patterns      []string
+	PatternsFiles []string `config:"patterns_files"`
 	Definitions   map[string]string
-	IgnoreMissing bool `config:"ignore_missing"`
-	DropField     bool `config:"drop_field"`
+}
+
+// captureTypes lists the supported capture types, like `%{NUMBER:field:int}`.
+var captureTypes = map[string]bool{
+	"int":     true,
+	"long":    true,
+	"float":   true,
+	"double":  true,
+	"boolean": true,
+}
+
+// lsCaptureTypes maps the capture types to the types supported by Logstash.
+// Logstash parses integers without size limit and floats with double
+// precision. Booleans are converted after matching.
+var lsCaptureTypes = map[string]string{
+	"int":    "int",
+	"long":   "int",
+	"float":  "float",
+	"double": "float",
 }
 
 func init() {
 	generator.Register("grok", makeGrok)
+	generator.RegisterIngestImport("grok", importIngest)
+	generator.RegisterLogstashImport("grok", importLogstash)
 }
 
-func makeGrok(cfg *common.Config) (generator.Processor, error) {
+func makeGrok(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -42,17 +70,135 @@ func makeGrok(cfg *common.Config) (generator.Processor, error) {
 		patterns = []string{config.Pattern}
 	}
 
+	definitions, err := loadDefinitions(ctx, patterns, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// capture names are stored as dotted field names and converted to field
+	// references for Logstash only
+	patterns, definitions = mapCaptures(patterns, definitions, fieldNames(ls.FieldPath))
+
+	all, err := gogrok.ParseCaptures(patterns, definitions)
+	if err != nil {
+		return nil, err
+	}
+	for i, captures := range all {
+		for _, capture := range captures {
+			if capture.Type != "" && !captureTypes[capture.Type] {
+				return nil, fmt.Errorf("pattern %v: type '%v' of field '%v' not supported",
+					i, capture.Type, capture.Field)
+			}
+		}
+	}
+
 	return &grok{
-		Field:         config.Field,
-		Patterns:      patterns,
-		Definitions:   config.Definitions,
-		IgnoreMissing: config.IgnoreMissing,
-		DropField:     config.DropField,
+		Field:       config.Field,
+		Patterns:    patterns,
+		Definitions: definitions,
+		captures:    all,
 	}, nil
 }
 
+// loadDefinitions merges the pattern files imported by the pipeline, the
+// pattern files and the definitions configured for the processor, in order of
+// precedence. Patterns from files are only included if referenced, such that
+// the generated configurations do not contain complete pattern libraries.
+func loadDefinitions(ctx *generator.LoadCtx, patterns []string, config config) (map[string]string, error) {
+	var files []string
+	files = append(files, ctx.Settings.Patterns...)
+	files = append(files, config.PatternsFiles...)
+	if len(files) == 0 {
+		return config.Definitions, nil
+	}
+
+	all := map[string]string{}
+	for _, file := range files {
+		defs, err := gogrok.LoadPatternFile(ctx.ResolvePath(file))
+		if err != nil {
+			return nil, err
+		}
+		for name, def := range defs {
+			all[name] = def
+		}
+	}
+	for name, def := range config.Definitions {
+		all[name] = def
+	}
+
+	definitions := gogrok.Referenced(patterns, all)
+	for name, def := range config.Definitions {
+		definitions[name] = def
+	}
+	return definitions, nil
+}
+
+// mapCaptures applies fn to the captures in all patterns and definitions.
+func mapCaptures(
+	patterns []string,
+	definitions map[string]string,
+	fn func(gogrok.Capture) gogrok.Capture,
+) ([]string, map[string]string) {
+	mapped := make([]string, len(patterns))
+	for i, p := range patterns {
+		mapped[i] = gogrok.MapCaptures(p, fn)
+	}
+
+	var defs map[string]string
+	if len(definitions) > 0 {
+		defs = make(map[string]string, len(definitions))
+		for name, p := range definitions {
+			defs[name] = gogrok.MapCaptures(p, fn)
+		}
+	}
+	return mapped, defs
+}
+
+// fieldNames creates a capture mapping function, applying fn to the field
+// names only.
+func fieldNames(fn func(string) string) func(gogrok.Capture) gogrok.Capture {
+	return func(c gogrok.Capture) gogrok.Capture {
+		c.Field = fn(c.Field)
+		return c
+	}
+}
+
 func (g *grok) Name() string { return "grok" }
 
+func (g *grok) SourceField() string { return g.Field }
+
+// Flow reports the named captures as written. Captures not present in all
+// patterns are only written if the pattern matches.
+func (g *grok) Flow() (generator.Flow, error) {
+	patterns := g.captures
+	var fields []string
+	count := map[string]int{}
+	for _, captures := range patterns {
+		seen := map[string]bool{}
+		for _, capture := range captures {
+			field := capture.Field
+			if seen[field] {
+				continue
+			}
+			seen[field] = true
+			if count[field] == 0 {
+				fields = append(fields, field)
+			}
+			count[field]++
+		}
+	}
+
+	flow := generator.Flow{Reads: []string{g.Field}}
+	for _, field := range fields {
+		if count[field] == len(patterns) {
+			flow.Writes = append(flow.Writes, field)
+		} else {
+			flow.MayWrite = append(flow.MayWrite, field)
+		}
+	}
+	return flow, nil
+}
+
 func (g *grok) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field":    g.Field,
@@ -61,42 +207,55 @@ func (g *grok) CompileIngest() ([]ingest.Processor, error) {
 	if len(g.Definitions) > 0 {
 		params["pattern_definitions"] = g.Definitions
 	}
-	if g.IgnoreMissing {
-		params["ignore_missing"] = true
-	}
 
-	ps := ingest.MakeSingleProcessor("grok", params)
-	if g.DropField {
-		ps = append(ps, ingest.RemoveField(g.Field))
-	}
-	return ps, nil
+	return ingest.MakeSingleProcessor("grok", params), nil
 }
 
+// CompileLogstash rewrites the capture names to field references, such that
+// grok creates nested fields. Capture types are mapped to the types supported
+// by Logstash. Booleans are converted by a ruby filter, parsing values like
+// Ingest Node.
+//
 // failure tag: config via `tag_on_failure` (default: `_grokparsefailure`)
 func (g *grok) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	failureTag := ctx.CreateTag("_failure_grok")
+	failureTag := ctx.CreateTag("_failure")
+
+	booleans := map[string]bool{}
+	patterns, definitions := mapCaptures(g.Patterns, g.Definitions, func(c gogrok.Capture) gogrok.Capture {
+		c.Field = ls.NormalizeField(c.Field)
+		if c.Type == "boolean" {
+			booleans[c.Field] = true
+		}
+		c.Type = lsCaptureTypes[c.Type]
+		return c
+	})
 
 	params := ls.Params{
 		"match": map[string]interface{}{
-			ls.NormalizeField(g.Field): g.Patterns,
+			ls.NormalizeField(g.Field): patterns,
 		},
 		"tag_on_failure": failureTag,
 	}
-	if len(g.Definitions) > 0 {
-		params["pattern_definitions"] = g.Definitions
+	if len(definitions) > 0 {
+		params["pattern_definitions"] = definitions
 	}
 
-	params.DropField(g.DropField, g.Field)
+	blk := ls.MakeBlock(ls.MakeFilter("grok", params))
+	if len(booleans) > 0 {
+		fields := make([]string, 0, len(booleans))
+		for field := range booleans {
+			fields = append(fields, "'"+field+"'")
+		}
+		sort.Strings(fields)
 
-	blk := ls.MakeBlock(
-		ls.MakeFilter("grok", params),
-
-		// TODO parse and fix field names in grok pattern instead of adding the
-		//      de_dot filter
-		ls.MakeFilter("de_dot", ls.Params{"nested": true}),
-	)
-	if g.IgnoreMissing {
-		blk = ls.IgnoreMissing(g.Field, blk)
+		code := fmt.Sprintf(`[%v].each { |f| v = event.get(f); event.set(f, v.casecmp('true') == 0) if v.is_a?(String) }`,
+			strings.Join(fields, ", "))
+		blk = append(blk, ls.Conditional{
+			Cond: []ls.Case{{
+				Cond:  ls.Expression(fmt.Sprintf(`"%v" not in [tags]`, failureTag)),
+				Block: ls.MakeBlock(ls.MakeFilter("ruby", ls.Params{"code": code})),
+			}},
+		})
 	}
 
 	return generator.FilterBlock{
@@ -105,6 +264,37 @@ func (g *grok) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBloc
 	}, nil
 }
 
+func (g *grok) CompileLocal() ([]local.Processor, error) {
+	matcher, err := gogrok.Compile(g.Patterns, g.Definitions)
+	if err != nil {
+		return nil, err
+	}
+
+	match := func(doc local.Document) error {
+		value, _, err := doc.StringField(g.Field, false)
+		if err != nil {
+			return err
+		}
+
+		fields, err := matcher.Match(value)
+		if err == gogrok.ErrNoMatch {
+			return fmt.Errorf("Provided Grok expressions do not match field value: [%v]", value)
+		}
+		if err != nil {
+			return err
+		}
+
+		for field, v := range fields {
+			if err := doc.Put(field, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return local.Single(match), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
@@ -120,3 +310,83 @@ func (c *config) Validate() error {
 
 	return nil
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":               "field",
+		"patterns":            "patterns",
+		"pattern_definitions": "definitions",
+		"ignore_missing":      "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("grok", config), nil
+}
+
+// importLogstash maps a grok filter with a single source field. Logstash
+// ignores events without the source field, so ignore_missing is enabled.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"match":               "match",
+		"pattern_definitions": "definitions",
+		"tag_on_failure":      "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generator.ImportTagOnFailure(config)
+
+	var field, patterns interface{}
+	switch match := config["match"].(type) {
+	case ls.Params:
+		if len(match) != 1 {
+			return nil, errors.New("match must configure exactly one field")
+		}
+		for k, v := range match {
+			field, patterns = k, v
+		}
+	case []interface{}:
+		if len(match) != 2 {
+			return nil, errors.New("match must configure exactly one field")
+		}
+		field, patterns = match[0], match[1]
+	default:
+		return nil, errors.New("missing match setting")
+	}
+	delete(config, "match")
+
+	if s, ok := patterns.(string); ok {
+		patterns = []interface{}{s}
+	}
+	if defs, ok := config["definitions"].(ls.Params); ok {
+		config["definitions"] = map[string]interface{}(defs)
+	}
+
+	// capture names are imported as dotted field names
+	fieldPaths := func(p interface{}) interface{} {
+		if s, ok := p.(string); ok {
+			return gogrok.MapCaptures(s, fieldNames(ls.FieldPath))
+		}
+		return p
+	}
+	if list, ok := patterns.([]interface{}); ok {
+		for i, p := range list {
+			list[i] = fieldPaths(p)
+		}
+	}
+	if defs, ok := config["definitions"].(map[string]interface{}); ok {
+		for name, p := range defs {
+			defs[name] = fieldPaths(p)
+		}
+	}
+
+	config["field"] = field
+	config["patterns"] = patterns
+	config["ignore_missing"] = true
+	if err := generator.ImportFields(config, "field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("grok", config)}, nil
+}
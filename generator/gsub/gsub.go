@@ -2,9 +2,13 @@ package gsub
 
 import (
 	"errors"
+	"regexp"
+	"strings"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
@@ -14,20 +18,19 @@ type gsub struct {
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	Pattern       string `validate:"required"`
-	Replacement   string `validate:"required"`
-	To            string `config:"target_field"`
-	IgnoreMissing bool   `config:"ignore_missing"`
-	IgnoreFailure bool   `config:"ignore_failure"`
-	DropField     bool   `config:"drop_field"`
+	Field       string `validate:"required"`
+	Pattern     string `validate:"required"`
+	Replacement string `validate:"required"`
+	To          string `config:"target_field"`
 }
 
 func init() {
 	generator.Register("gsub", makeGsub)
+	generator.RegisterIngestImport("gsub", importIngest)
+	generator.RegisterLogstashImport("mutate.gsub", importLogstash)
 }
 
-func makeGsub(cfg *common.Config) (generator.Processor, error) {
+func makeGsub(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -42,6 +45,16 @@ func defaultConfig() config {
 
 func (g *gsub) Name() string { return "gsub" }
 
+func (g *gsub) SourceField() string { return g.Field }
+
+func (g *gsub) Flow() (generator.Flow, error) {
+	to := g.To
+	if to == "" {
+		to = g.Field
+	}
+	return generator.Flow{Reads: []string{g.Field}, Writes: []string{to}}, nil
+}
+
 func (g *gsub) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field":       g.Field,
@@ -51,21 +64,141 @@ func (g *gsub) CompileIngest() ([]ingest.Processor, error) {
 	if g.To != "" {
 		params["target_field"] = g.To
 	}
-	if g.IgnoreMissing {
-		params["ignore_missing"] = true
+
+	return ingest.MakeSingleProcessor("gsub", params), nil
+}
+
+// failure tag: none, need to generate custom tag handling
+func (g *gsub) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	field := g.Field
+	blk := ls.MakeBlock()
+	if g.To != "" {
+		// mutate applies copy after gsub -> copy in separate filter first
+		field = g.To
+		blk = append(blk, ls.MakeFilter("mutate", ls.Params{
+			"copy": ls.Params{
+				ls.NormalizeField(g.Field): ls.NormalizeField(g.To),
+			},
+		}))
 	}
-	if g.IgnoreFailure {
-		params["ignore_failure"] = true
+
+	params := ls.Params{
+		"gsub": []string{
+			ls.NormalizeField(field),
+			g.Pattern,
+			rubyReplacement(g.Replacement),
+		},
 	}
+	params.RemoveTag(failureTag)
+
+	blk = append(blk, ls.MakeFilter("mutate", params))
+	blk = ls.RunWithTags(blk, failureTag)
 
-	ps := ingest.MakeSingleProcessor("gsub", params)
-	if g.DropField {
-		ps = append(ps, ingest.RemoveField(g.Field))
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "gsub", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (g *gsub) CompileLocal() ([]local.Processor, error) {
+	re, err := regexp.Compile(g.Pattern)
+	if err != nil {
+		return nil, err
 	}
 
-	return ps, nil
+	replacement := goReplacement(g.Replacement)
+	to := g.Field
+	if g.To != "" {
+		to = g.To
+	}
+
+	replace := func(doc local.Document) error {
+		value, _, err := doc.StringField(g.Field, false)
+		if err != nil {
+			return err
+		}
+		return doc.Put(to, re.ReplaceAllString(value, replacement))
+	}
+
+	return local.Single(replace), nil
 }
 
-func (g *gsub) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	return generator.FilterBlock{}, errors.New("TODO (logstash gsub)")
+var javaGroupRef = regexp.MustCompile(`\$(\d+|\{\w+\})`)
+
+// rubyReplacement rewrites java style group references (`$1`, `${name}`) into
+// the ruby gsub replacement syntax (`\1`, `\k<name>`).
+func rubyReplacement(s string) string {
+	return javaGroupRef.ReplaceAllStringFunc(s, func(ref string) string {
+		ref = ref[1:]
+		if ref[0] == '{' {
+			return `\k<` + ref[1:len(ref)-1] + ">"
+		}
+		return `\` + ref
+	})
+}
+
+// goReplacement rewrites java style group references into the go regexp
+// expansion syntax (`${1}`, `${name}`).
+func goReplacement(s string) string {
+	return javaGroupRef.ReplaceAllStringFunc(s, func(ref string) string {
+		ref = strings.Trim(ref[1:], "{}")
+		return "${" + ref + "}"
+	})
+}
+
+var rubyGroupRef = regexp.MustCompile(`\\(\d+|k<\w+>)`)
+
+// javaReplacement rewrites ruby gsub group references (`\1`, `\k<name>`) into
+// the java syntax (`$1`, `${name}`). It is the inverse of rubyReplacement.
+func javaReplacement(s string) string {
+	return rubyGroupRef.ReplaceAllStringFunc(s, func(ref string) string {
+		ref = ref[1:]
+		if ref[0] == 'k' {
+			return "${" + ref[2:len(ref)-1] + "}"
+		}
+		return "$" + ref
+	})
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"pattern":        "pattern",
+		"replacement":    "replacement",
+		"target_field":   "target_field",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("gsub", config), nil
+}
+
+// importLogstash creates a gsub processor per field. Missing fields are
+// ignored, like in Logstash.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	list, ok := params["gsub"].([]interface{})
+	if !ok || len(list)%3 != 0 {
+		return nil, errors.New("gsub must be a list of field, pattern and replacement")
+	}
+
+	var configs []map[string]interface{}
+	for i := 0; i < len(list); i += 3 {
+		field, ok1 := list[i].(string)
+		pattern, ok2 := list[i+1].(string)
+		replacement, ok3 := list[i+2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.New("gsub settings must be strings")
+		}
+
+		configs = append(configs, generator.MakeImport("gsub", map[string]interface{}{
+			"field":          ls.FieldPath(field),
+			"pattern":        pattern,
+			"replacement":    javaReplacement(replacement),
+			"ignore_missing": true,
+		}))
+	}
+	return configs, nil
 }
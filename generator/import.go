@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/urso/bpb/prog/ls"
+)
+
+// IngestImporter converts the parameters of an Ingest Node processor into a
+// processor configuration. The configuration must hold exactly one entry,
+// mapping the registered processor name to its settings. The common options
+// tag, description, ignore_failure and on_failure are handled by the caller.
+type IngestImporter func(params map[string]interface{}) (map[string]interface{}, error)
+
+// LogstashImporter converts the settings of a Logstash filter into processor
+// configurations. Importers for mutate operations are registered as
+// `mutate.<operation>` and receive the operation setting only. Common filter
+// options like remove_field are handled by the caller.
+type LogstashImporter func(params ls.Params) ([]map[string]interface{}, error)
+
+var (
+	ingestImporters   = map[string]IngestImporter{}
+	logstashImporters = map[string]LogstashImporter{}
+)
+
+func RegisterIngestImport(processor string, f IngestImporter) {
+	if ingestImporters[processor] != nil {
+		panic(fmt.Errorf("Ingest importer for %v already registered", processor))
+	}
+	ingestImporters[processor] = f
+}
+
+func FindIngestImport(processor string) IngestImporter {
+	return ingestImporters[processor]
+}
+
+func RegisterLogstashImport(filter string, f LogstashImporter) {
+	if logstashImporters[filter] != nil {
+		panic(fmt.Errorf("Logstash importer for %v already registered", filter))
+	}
+	logstashImporters[filter] = f
+}
+
+func FindLogstashImport(filter string) LogstashImporter {
+	return logstashImporters[filter]
+}
+
+// ImportParams renames the parameters using the settings mapping. An error is
+// returned if a parameter has no mapping.
+func ImportParams(params map[string]interface{}, settings map[string]string) (map[string]interface{}, error) {
+	var unknown []string
+	config := map[string]interface{}{}
+	for k, v := range params {
+		name, exists := settings[k]
+		if !exists {
+			unknown = append(unknown, k)
+			continue
+		}
+		config[name] = v
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unsupported parameters %v", unknown)
+	}
+	return config, nil
+}
+
+// MakeImport creates the processor configuration returned by importers.
+func MakeImport(name string, config map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{name: config}
+}
+
+// ImportTagOnFailure removes the tag_on_failure setting from an imported
+// Logstash filter configuration. Failures are reported by the generated
+// pipelines, but an empty tag list disables failure reporting and is mapped to
+// ignore_failure.
+func ImportTagOnFailure(config map[string]interface{}) {
+	tags, exists := config["tag_on_failure"]
+	if !exists {
+		return
+	}
+
+	delete(config, "tag_on_failure")
+	if list, ok := tags.([]interface{}); ok && len(list) == 0 {
+		config["ignore_failure"] = true
+	}
+}
+
+// ImportFields converts the Logstash field references in the named settings
+// into field names.
+func ImportFields(config map[string]interface{}, names ...string) error {
+	for _, name := range names {
+		v, exists := config[name]
+		if !exists {
+			continue
+		}
+
+		ref, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("setting '%v' must be a field reference", name)
+		}
+		config[name] = ls.FieldPath(ref)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package json
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
@@ -14,17 +18,17 @@ type processor struct {
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	To            string `config:"target_field"`
-	IgnoreFailure bool   `config:"ignore_failure"`
-	DropField     bool   `config:"drop_field"`
+	Field string `validate:"required"`
+	To    string `config:"target_field"`
 }
 
 func init() {
 	generator.Register("json", makeProcessor)
+	generator.RegisterIngestImport("json", importIngest)
+	generator.RegisterLogstashImport("json", importLogstash)
 }
 
-func makeProcessor(cfg *common.Config) (generator.Processor, error) {
+func makeProcessor(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -33,12 +37,56 @@ func makeProcessor(cfg *common.Config) (generator.Processor, error) {
 	return &processor{config}, nil
 }
 
+func (p *processor) CompileLocal() ([]local.Processor, error) {
+	decode := func(doc local.Document) error {
+		value, _, err := doc.StringField(p.Field, false)
+		if err != nil {
+			return err
+		}
+
+		var decoded interface{}
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return err
+		}
+
+		if p.To != "" {
+			return doc.Put(p.To, decoded)
+		}
+
+		fields, ok := decoded.(map[string]interface{})
+		if !ok {
+			return errors.New("cannot add non-map fields to root of document")
+		}
+		for k, v := range fields {
+			doc[k] = v
+		}
+		return nil
+	}
+
+	return local.Single(decode), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
 
 func (p *processor) Name() string { return "json" }
 
+func (p *processor) SourceField() string { return p.Field }
+
+// Flow reports the event root as extended if no target is configured.
+func (p *processor) Flow() (generator.Flow, error) {
+	flow := generator.Flow{Reads: []string{p.Field}}
+	if p.To != "" {
+		flow.Writes = []string{p.To}
+	} else {
+		flow.Extends = []string{""}
+	}
+	return flow, nil
+}
+
 func (p *processor) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field": p.Field,
@@ -48,17 +96,74 @@ func (p *processor) CompileIngest() ([]ingest.Processor, error) {
 	} else {
 		params["add_to_root"] = true
 	}
-	if p.IgnoreFailure {
-		params["ignore_failure"] = true
+
+	return ingest.MakeSingleProcessor("json", params), nil
+}
+
+// failure tag: config via `tag_on_failure` (default: `_jsonparsefailure`)
+func (p *processor) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	// no target configured -> json filter decodes into the event root
+	params := ls.Params{
+		"source":         ls.NormalizeField(p.Field),
+		"tag_on_failure": []string{failureTag},
+	}
+	params.Target(p.To)
+
+	return generator.FilterBlock{
+		Block: ls.MakeVerboseBlock(ctx.Verbose, "json",
+			ls.MakeFilter("json", params),
+		),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":        "field",
+		"target_field": "target_field",
+		"add_to_root":  "add_to_root",
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	ps := ingest.MakeSingleProcessor("json", params)
-	if p.DropField {
-		ps = append(ps, ingest.RemoveField(p.Field))
+	// Without target_field the decoded object is added to the document root.
+	// Ingest Node decodes into the source field instead, unless add_to_root
+	// is set.
+	addToRoot, _ := config["add_to_root"].(bool)
+	delete(config, "add_to_root")
+	if addToRoot {
+		if _, exists := config["target_field"]; exists {
+			return nil, errors.New("add_to_root and target_field are exclusive")
+		}
+	} else if _, exists := config["target_field"]; !exists {
+		config["target_field"] = config["field"]
 	}
-	return ps, nil
+
+	return generator.MakeImport("json", config), nil
 }
 
-func (p *processor) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	return generator.FilterBlock{}, errors.New("TODO (logstash json)")
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source":               "field",
+		"target":               "target_field",
+		"skip_on_invalid_json": "skip_on_invalid_json",
+		"tag_on_failure":       "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generator.ImportTagOnFailure(config)
+	if skip, _ := config["skip_on_invalid_json"].(bool); skip {
+		config["ignore_failure"] = true
+	}
+	delete(config, "skip_on_invalid_json")
+
+	if err := generator.ImportFields(config, "field", "target_field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("json", config)}, nil
 }
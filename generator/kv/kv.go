@@ -3,9 +3,12 @@ package kv
 import (
 	"errors"
 	"fmt"
+	"regexp"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
 )
@@ -15,12 +18,10 @@ type kv struct {
 }
 
 type config struct {
-	Field         string      `validate:"required"`
-	To            string      `config:"target_field" validate:"required"`
-	FieldSplit    splitConfig `config:"split.field"`
-	ValueSplit    splitConfig `config:"split.value"`
-	IgnoreMissing bool        `config:"ignore_missing"`
-	IgnoreFailure bool        `config:"ignore_failure"`
+	Field      string      `validate:"required"`
+	To         string      `config:"target_field" validate:"required"`
+	FieldSplit splitConfig `config:"split.field"`
+	ValueSplit splitConfig `config:"split.value"`
 }
 
 type splitConfig struct {
@@ -39,9 +40,11 @@ const (
 
 func init() {
 	generator.Register("key_value", makeKV)
+	generator.RegisterIngestImport("kv", importIngest)
+	generator.RegisterLogstashImport("kv", importLogstash)
 }
 
-func makeKV(cfg *common.Config) (generator.Processor, error) {
+func makeKV(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -54,6 +57,13 @@ func (k *kv) Name() string {
 	return "kv"
 }
 
+func (k *kv) SourceField() string { return k.Field }
+
+// Flow reports the target as extended, as the keys are not known in advance.
+func (k *kv) Flow() (generator.Flow, error) {
+	return generator.Flow{Reads: []string{k.Field}, Extends: []string{k.To}}, nil
+}
+
 func (k *kv) CompileIngest() ([]ingest.Processor, error) {
 	fieldSplit, err := ingestPattern(k.FieldSplit)
 	if err != nil {
@@ -73,18 +83,67 @@ func (k *kv) CompileIngest() ([]ingest.Processor, error) {
 	if k.To != "" {
 		params["target_field"] = k.To
 	}
-	if k.IgnoreMissing {
-		params["ignore_missing"] = true
-	}
-	if k.IgnoreFailure {
-		params["ignore_failure"] = true
-	}
 
 	return ingest.MakeSingleProcessor("kv", params), nil
 }
 
+// failure tag: config via `tag_on_failure` (default: `_kv_filter_error`)
 func (k *kv) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	return generator.FilterBlock{}, errors.New("TODO (logstash kv filter)")
+	failureTag := ctx.CreateTag("_failure")
+
+	params := ls.Params{
+		"source": ls.NormalizeField(k.Field),
+	}
+	if err := logstashSplit(params, "field_split", k.FieldSplit); err != nil {
+		return generator.FilterBlock{}, fmt.Errorf("%v on field", err)
+	}
+	if err := logstashSplit(params, "value_split", k.ValueSplit); err != nil {
+		return generator.FilterBlock{}, fmt.Errorf("%v on value", err)
+	}
+	params.Target(k.To)
+	params["tag_on_failure"] = failureTag
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "kv", ls.MakeFilter("kv", params)),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (k *kv) CompileLocal() ([]local.Processor, error) {
+	fieldSplit, err := localPattern(k.FieldSplit)
+	if err != nil {
+		return nil, fmt.Errorf("%v on field", err)
+	}
+
+	valueSplit, err := localPattern(k.ValueSplit)
+	if err != nil {
+		return nil, fmt.Errorf("%v on value", err)
+	}
+
+	split := func(doc local.Document) error {
+		value, _, err := doc.StringField(k.Field, false)
+		if err != nil {
+			return err
+		}
+
+		for _, pair := range local.SplitRegex(fieldSplit, value) {
+			kv := valueSplit.Split(pair, 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("field [%v] does not contain value_split [%v]", k.Field, valueSplit)
+			}
+
+			key := kv[0]
+			if k.To != "" {
+				key = k.To + "." + key
+			}
+			if err := doc.Append(key, kv[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return local.Single(split), nil
 }
 
 func defaultConfig() config {
@@ -133,3 +192,99 @@ func ingestPattern(c splitConfig) (string, error) {
 		return "", errors.New("no split mode configured")
 	}
 }
+
+func localPattern(c splitConfig) (*regexp.Regexp, error) {
+	pattern, err := ingestPattern(c)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(pattern)
+}
+
+// logstashSplit configures the kv filter split setting. Class mode uses the
+// plain `<setting>` option (set of characters), regex mode the
+// `<setting>_pattern` option.
+func logstashSplit(params ls.Params, setting string, c splitConfig) error {
+	switch c.mode {
+	case classSplitMode:
+		params[setting] = c.pattern
+	case regexSplitMode:
+		params[setting+"_pattern"] = c.pattern
+	default:
+		return errors.New("no split mode configured")
+	}
+	return nil
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_field":   "target_field",
+		"field_split":    "field_split",
+		"value_split":    "value_split",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ingest Node split settings are always regular expressions
+	split := map[string]interface{}{}
+	for _, name := range []string{"field", "value"} {
+		if pattern, exists := config[name+"_split"]; exists {
+			split[name] = map[string]interface{}{"regex": pattern}
+			delete(config, name+"_split")
+		}
+	}
+	config["split"] = split
+
+	return generator.MakeImport("key_value", config), nil
+}
+
+// importLogstash maps a kv filter. Logstash ignores events without the source
+// field, so ignore_missing is enabled.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source":              "field",
+		"target":              "target_field",
+		"field_split":         "field_split",
+		"field_split_pattern": "field_split_pattern",
+		"value_split":         "value_split",
+		"value_split_pattern": "value_split_pattern",
+		"tag_on_failure":      "tag_on_failure",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := config["field"]; !exists {
+		config["field"] = "message"
+	}
+	if _, exists := config["target_field"]; !exists {
+		return nil, errors.New("kv filters without target are not supported")
+	}
+
+	// split settings default to the Logstash defaults
+	split := map[string]interface{}{}
+	for name, def := range map[string]string{"field": " ", "value": "="} {
+		setting := name + "_split"
+		switch {
+		case config[setting+"_pattern"] != nil:
+			split[name] = map[string]interface{}{"regex": config[setting+"_pattern"]}
+		case config[setting] != nil:
+			split[name] = map[string]interface{}{"class": config[setting]}
+		default:
+			split[name] = map[string]interface{}{"class": def}
+		}
+		delete(config, setting)
+		delete(config, setting+"_pattern")
+	}
+	config["split"] = split
+	config["ignore_missing"] = true
+
+	generator.ImportTagOnFailure(config)
+	if err := generator.ImportFields(config, "field", "target_field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("key_value", config)}, nil
+}
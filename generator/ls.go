@@ -12,6 +12,17 @@ type LogstashCtx struct {
 	DisableErrors bool
 
 	tagCount uint
+
+	// failureTag is added to failed events if the pipeline has custom
+	// on_failure processors.
+	failureTag string
+
+	// tag of the processor being compiled, used to derive failure tags and
+	// filter ids
+	tag string
+
+	// failure tags and filter ids already in use
+	used map[string]bool
 }
 
 type FilterBlock struct {
@@ -19,12 +30,33 @@ type FilterBlock struct {
 	FailureTags []string
 }
 
+// CreateTag creates a failure tag. The tag is derived from the tag of the
+// processor being compiled, such that failure tags stay stable if processors
+// are added or removed.
 func (ctx *LogstashCtx) CreateTag(name string) string {
-	ctx.tagCount++
 	if name == "" {
 		name = "_logstash_tag"
 	}
-	return fmt.Sprintf("%v_%v", name, ctx.tagCount)
+	if ctx.tag != "" {
+		return ctx.unique(name + "_" + ctx.tag)
+	}
+
+	ctx.tagCount++
+	return ctx.unique(fmt.Sprintf("%v_%v", name, ctx.tagCount))
+}
+
+// unique appends a counter to name, if name has already been used.
+func (ctx *LogstashCtx) unique(name string) string {
+	if ctx.used == nil {
+		ctx.used = map[string]bool{}
+	}
+
+	id := name
+	for i := 2; ctx.used[id]; i++ {
+		id = fmt.Sprintf("%v_%v", name, i)
+	}
+	ctx.used[id] = true
+	return id
 }
 
 func (b *FilterBlock) Append(b2 FilterBlock) {
@@ -95,13 +127,15 @@ func CompileLogstashProcessors(
 				continue
 			}
 
-			errBlk := onError(input[i].Name(), blk.FailureTags)
+			name := processorTag(ctx, input[i])
+			errBlk := onError(name, blk.FailureTags)
 			failTags = append(failTags, errBlk.FailureTags...)
 
 			onFail := ls.MakeBlock(ls.MakeFilter("mutate", ls.Params{
 				"remove_tag": blk.FailureTags,
 			}))
 			onFail = append(onFail, errBlk.Block...)
+			setLSFilterIDs(ctx, onFail, name+"_failure")
 
 			conds[i] = ls.Conditional{
 				Cond: []ls.Case{
@@ -135,6 +169,33 @@ func CompileLogstashProcessors(
 	}, nil
 }
 
+// setLSFilterIDs sets the `id` of all filters in the block, that have no id
+// yet. The ids are derived from base.
+func setLSFilterIDs(ctx *LogstashCtx, blk ls.Block, base string) {
+	for i, stmt := range blk {
+		switch stmt := stmt.(type) {
+		case ls.Filter:
+			if _, exists := stmt.Params["id"]; exists {
+				continue
+			}
+			if stmt.Params == nil {
+				stmt.Params = ls.Params{}
+			}
+			stmt.Params["id"] = ctx.unique(base)
+			blk[i] = stmt
+
+		case ls.Block:
+			setLSFilterIDs(ctx, stmt, base)
+
+		case ls.Conditional:
+			for _, c := range stmt.Cond {
+				setLSFilterIDs(ctx, c.Block, base)
+			}
+			setLSFilterIDs(ctx, stmt.Else, base)
+		}
+	}
+}
+
 func makeLSFailTagsCondition(tags []string) string {
 	if len(tags) == 0 {
 		return ""
@@ -148,6 +209,24 @@ func makeLSFailTagsCondition(tags []string) string {
 	return strings.Join(cmps, `or`)
 }
 
+// makeLSNoFailTagsCondition creates a condition checking none of the failure
+// tags is set.
+func makeLSNoFailTagsCondition(tags []string) string {
+	var checks []string
+	for _, tag := range tags {
+		if tag != "" {
+			checks = append(checks, fmt.Sprintf(`"%v" not in [tags]`, tag))
+		}
+	}
+	return strings.Join(checks, " and ")
+}
+
+// RubyString quotes s as single quoted ruby string literal.
+func RubyString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, `'`, `\'`, -1) + "'"
+}
+
 // TODO: add support for versioning, tag_on_exception not available in 6.0 yet
 func MakeRuby(ctx *LogstashCtx, code, failureTag string, extra ls.Params) ls.Block {
 	params := ls.Params{
@@ -170,6 +249,16 @@ func MakeRuby(ctx *LogstashCtx, code, failureTag string, extra ls.Params) ls.Blo
 }
 
 func MakeLSErrorReporter(ctx *LogstashCtx) func(string, []string) FilterBlock {
+	if tag := ctx.failureTag; tag != "" {
+		return func(string, []string) FilterBlock {
+			return FilterBlock{
+				Block: ls.MakeBlock(ls.MakeFilter("mutate", ls.Params{
+					"add_tag": []string{tag},
+				})),
+			}
+		}
+	}
+
 	return func(filter string, tags []string) FilterBlock {
 		msg := fmt.Sprintf(`filter %v (tags: %v) failed`, filter, tags)
 		code := fmt.Sprintf(`msg='%v'; field='[error][message]'; old=event.get(field); event.set(field, old ? [event.get(field), msg].join(' : ') : msg)`, msg)
@@ -0,0 +1,239 @@
+package normalize
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// mutation modifies string fields in place or stores the result in the
+// target field. The operations are available as Ingest Node processors and
+// Logstash mutate operations.
+type mutation struct {
+	config
+	op operation
+}
+
+type operation struct {
+	name string
+
+	// mutate is the Logstash mutate operation
+	mutate string
+
+	fn func(string) string
+}
+
+type config struct {
+	Field  string
+	Fields []string
+	To     string `config:"target_field"`
+}
+
+var operations = []operation{
+	{name: "lowercase", mutate: "lowercase", fn: strings.ToLower},
+	{name: "uppercase", mutate: "uppercase", fn: strings.ToUpper},
+	{name: "trim", mutate: "strip", fn: strings.TrimSpace},
+}
+
+func init() {
+	for _, op := range operations {
+		op := op
+		generator.Register(op.name, func(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+			return makeMutation(op, cfg)
+		})
+		generator.RegisterIngestImport(op.name, func(params map[string]interface{}) (map[string]interface{}, error) {
+			return importIngest(op.name, params)
+		})
+		generator.RegisterLogstashImport("mutate."+op.mutate, func(params ls.Params) ([]map[string]interface{}, error) {
+			return importLogstash(op, params)
+		})
+	}
+}
+
+func makeMutation(op operation, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	config.normalize()
+	return &mutation{config: config, op: op}, nil
+}
+
+func (m *mutation) Name() string { return m.op.name }
+
+func (m *mutation) SourceField() string { return m.Field }
+
+func (m *mutation) SplitFields() []generator.Processor {
+	var ps []generator.Processor
+	for _, field := range m.Fields {
+		ps = append(ps, &mutation{config: config{Field: field}, op: m.op})
+	}
+	return ps
+}
+
+func (m *mutation) Flow() (generator.Flow, error) {
+	return m.flow(), nil
+}
+
+func (m *mutation) CompileIngest() ([]ingest.Processor, error) {
+	var ps []ingest.Processor
+	for _, field := range m.sources() {
+		params := map[string]interface{}{"field": field}
+		if m.To != "" {
+			params["target_field"] = m.To
+		}
+		ps = append(ps, ingest.MakeProcessor(m.op.name, params))
+	}
+	return ps, nil
+}
+
+// CompileLogstash copies the field to the target field first, as the mutate
+// operations modify fields in place.
+//
+// failure tag: none, need to generate custom tag handling
+func (m *mutation) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	var fields []string
+	for _, field := range m.targets() {
+		fields = append(fields, ls.NormalizeField(field))
+	}
+
+	var blk ls.Block
+	if m.To != "" {
+		blk = append(blk, ls.MakeFilter("mutate", ls.Params{
+			"copy": ls.Params{ls.NormalizeField(m.Field): ls.NormalizeField(m.To)},
+		}))
+	}
+
+	params := ls.Params{m.op.mutate: fields}
+	params.RemoveTag(failureTag)
+	blk = append(blk, ls.MakeFilter("mutate", params))
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, m.op.name, ls.RunWithTags(blk, failureTag)...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (m *mutation) CompileLocal() ([]local.Processor, error) {
+	return m.compileLocal(func(s string) (string, error) {
+		return m.op.fn(s), nil
+	}), nil
+}
+
+func defaultConfig() config {
+	return config{}
+}
+
+// Validate requires either field or fields to be configured. The target field
+// is supported for single fields only.
+func (c *config) Validate() error {
+	if (c.Field == "") == (len(c.Fields) == 0) {
+		return errors.New("one of field or fields must be configured")
+	}
+	if c.To != "" && len(c.Fields) > 1 {
+		return errors.New("target_field not supported with multiple fields")
+	}
+	return nil
+}
+
+// normalize stores a single entry of fields in field.
+func (c *config) normalize() {
+	if len(c.Fields) == 1 {
+		c.Field, c.Fields = c.Fields[0], nil
+	}
+}
+
+func (c *config) sources() []string {
+	if c.Field != "" {
+		return []string{c.Field}
+	}
+	return c.Fields
+}
+
+func (c *config) targets() []string {
+	if c.To != "" {
+		return []string{c.To}
+	}
+	return c.sources()
+}
+
+func (c *config) flow() generator.Flow {
+	return generator.Flow{Reads: c.sources(), Writes: c.targets()}
+}
+
+// compileLocal applies fn to the source fields.
+func (c *config) compileLocal(fn func(string) (string, error)) []local.Processor {
+	return local.Single(func(doc local.Document) error {
+		for _, field := range c.sources() {
+			s, _, err := doc.StringField(field, false)
+			if err != nil {
+				return err
+			}
+
+			if s, err = fn(s); err != nil {
+				return err
+			}
+
+			to := field
+			if c.To != "" {
+				to = c.To
+			}
+			if err := doc.Put(to, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func importIngest(name string, params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_field":   "target_field",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport(name, config), nil
+}
+
+// importLogstash creates a processor for all fields. Missing fields are
+// ignored, like in Logstash.
+func importLogstash(op operation, params ls.Params) ([]map[string]interface{}, error) {
+	var refs []interface{}
+	switch v := params[op.mutate].(type) {
+	case []interface{}:
+		refs = v
+	case string:
+		refs = []interface{}{v}
+	default:
+		return nil, errors.New(op.mutate + " must be a list of field references")
+	}
+
+	fields := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		s, ok := ref.(string)
+		if !ok {
+			return nil, errors.New(op.mutate + " must be a list of field references")
+		}
+		fields[i] = ls.FieldPath(s)
+	}
+
+	config := map[string]interface{}{"ignore_missing": true}
+	if len(fields) == 1 {
+		config["field"] = fields[0]
+	} else {
+		config["fields"] = fields
+	}
+	return []map[string]interface{}{generator.MakeImport(op.name, config)}, nil
+}
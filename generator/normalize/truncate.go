@@ -0,0 +1,156 @@
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// truncate shortens strings to a maximum number of characters. Characters are
+// counted in unicode code points on all backends. Ingest Node has no truncate
+// processor, a painless script is generated instead.
+type truncate struct {
+	config
+	length int
+}
+
+type truncateConfig struct {
+	Field  string
+	Fields []string
+	To     string `config:"target_field"`
+	Length int    `validate:"required,min=1"`
+}
+
+var painlessIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func init() {
+	generator.Register("truncate", makeTruncate)
+}
+
+func makeTruncate(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	var tc truncateConfig
+	if err := cfg.Unpack(&tc); err != nil {
+		return nil, err
+	}
+
+	config := config{Field: tc.Field, Fields: tc.Fields, To: tc.To}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.normalize()
+	return &truncate{config: config, length: tc.Length}, nil
+}
+
+func (t *truncate) Name() string { return "truncate" }
+
+func (t *truncate) SourceField() string { return t.Field }
+
+func (t *truncate) SplitFields() []generator.Processor {
+	var ps []generator.Processor
+	for _, field := range t.Fields {
+		ps = append(ps, &truncate{config: config{Field: field}, length: t.length})
+	}
+	return ps
+}
+
+func (t *truncate) Flow() (generator.Flow, error) {
+	return t.flow(), nil
+}
+
+func (t *truncate) CompileIngest() ([]ingest.Processor, error) {
+	var ps []ingest.Processor
+	for _, field := range t.sources() {
+		to := field
+		if t.To != "" {
+			to = t.To
+		}
+
+		code, err := painlessTruncate(field, to)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, ingest.MakeProcessor("script", map[string]interface{}{
+			"lang":   "painless",
+			"source": code,
+			"params": map[string]interface{}{"length": t.length},
+		}))
+	}
+	return ps, nil
+}
+
+// painlessTruncate creates the script truncating field into the target
+// field. Missing objects of the target field are created.
+func painlessTruncate(field, to string) (string, error) {
+	get, err := painlessPath(field, "?.")
+	if err != nil {
+		return "", err
+	}
+	set, err := painlessPath(to, ".")
+	if err != nil {
+		return "", err
+	}
+
+	var code []string
+	code = append(code,
+		fmt.Sprintf(`def v = %v;`, get),
+		fmt.Sprintf(`if (v == null) { throw new IllegalArgumentException('field [%v] not present as part of path [%v]'); }`, field, field),
+		fmt.Sprintf(`if (!(v instanceof String)) { throw new IllegalArgumentException('field [%v] of type [' + v.getClass().getName() + '] cannot be cast to [java.lang.String]'); }`, field),
+	)
+
+	names := strings.Split(to, ".")
+	for i := 1; i < len(names); i++ {
+		parent := "ctx." + strings.Join(names[:i], ".")
+		code = append(code, fmt.Sprintf(`if (%v == null) { %v = [:]; }`, parent, parent))
+	}
+	code = append(code, fmt.Sprintf(`%v = v.codePointCount(0, v.length()) > params.length ? v.substring(0, v.offsetByCodePoints(0, params.length)) : v;`, set))
+	return strings.Join(code, " "), nil
+}
+
+func painlessPath(field, sep string) (string, error) {
+	names := strings.Split(field, ".")
+	for _, name := range names {
+		if !painlessIdentifier.MatchString(name) {
+			return "", fmt.Errorf("field name '%v' not supported in painless scripts", field)
+		}
+	}
+	return "ctx." + strings.Join(names, sep), nil
+}
+
+// failure tag: none, need to generate custom tag handling
+func (t *truncate) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	var code []string
+	for _, field := range t.sources() {
+		to := field
+		if t.To != "" {
+			to = t.To
+		}
+
+		code = append(code, fmt.Sprintf(
+			`v = event.get('%v'); raise 'field [%v] not present as part of path [%v]' if v.nil?; raise 'field [%v] is no string' unless v.is_a?(String); event.set('%v', v[0, %v])`,
+			ls.NormalizeField(field), field, field, field, ls.NormalizeField(to), t.length))
+	}
+
+	blk := generator.MakeRuby(ctx, strings.Join(code, "; "), failureTag, nil)
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "truncate", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (t *truncate) CompileLocal() ([]local.Processor, error) {
+	return t.compileLocal(func(s string) (string, error) {
+		if runes := []rune(s); len(runes) > t.length {
+			return string(runes[:t.length]), nil
+		}
+		return s, nil
+	}), nil
+}
@@ -0,0 +1,438 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urso/bpb/prog/cond"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// Options are the settings supported by all processors. The options are
+// removed from the processor configuration by the registry and applied to
+// the compiled processors.
+type Options struct {
+	If            string
+	ID            string
+	Tag           string
+	Description   string
+	IgnoreFailure bool             `config:"ignore_failure"`
+	IgnoreMissing bool             `config:"ignore_missing"`
+	DropField     bool             `config:"drop_field"`
+	OnFailure     []*common.Config `config:"on_failure"`
+}
+
+// FieldProcessor is implemented by processors reading a single source field.
+// The source field is required by the ignore_missing and drop_field options.
+type FieldProcessor interface {
+	SourceField() string
+}
+
+// FieldsProcessor is implemented by processors applying the same operation to
+// multiple source fields. The processor is split into one processor per field
+// for the ignore_missing and drop_field options to apply to each field. The
+// split processors must implement FieldProcessor. SplitFields returns nil if
+// the processor has a single source field only.
+type FieldsProcessor interface {
+	SplitFields() []Processor
+}
+
+// IgnoreMissingProcessor is implemented by processors reading multiple source
+// fields, that handle missing fields themselves. WithIgnoreMissing returns the
+// processor configured with the ignore_missing option.
+type IgnoreMissingProcessor interface {
+	WithIgnoreMissing(ignore bool) Processor
+}
+
+// OptionsDefaulter is implemented by processors using non-zero default
+// values for the common options.
+type OptionsDefaulter interface {
+	DefaultOptions() Options
+}
+
+// OptionsValidator is implemented by processors with additional requirements
+// on the common options.
+type OptionsValidator interface {
+	ValidateOptions(opts Options) error
+}
+
+var optionNames = []string{
+	"if", "id", "tag", "description", "ignore_failure", "ignore_missing",
+	"drop_field", "on_failure",
+}
+
+// ingestIgnoreMissing lists the ingest processors supporting the
+// ignore_missing setting.
+var ingestIgnoreMissing = map[string]bool{
+	"bytes":        true,
+	"community_id": true,
+	"convert":      true,
+	"csv":          true,
+	"dissect":      true,
+	"fingerprint":  true,
+	"geoip":        true,
+	"grok":         true,
+	"gsub":         true,
+	"html_strip":   true,
+	"kv":           true,
+	"lowercase":    true,
+	"remove":       true,
+	"rename":       true,
+	"split":        true,
+	"trim":         true,
+	"uppercase":    true,
+	"uri_parts":    true,
+	"urldecode":    true,
+	"user_agent":   true,
+}
+
+type (
+	// fieldGuard runs the processor only if the source field is present. It
+	// is configured via the `ignore_missing` option.
+	fieldGuard struct {
+		Processor
+		field string
+	}
+
+	// fieldDrop removes the source field if the processor succeeds. It is
+	// configured via the `drop_field` option.
+	fieldDrop struct {
+		Processor
+		field string
+	}
+
+	// fieldSplit runs the processors created by FieldsProcessor in order.
+	fieldSplit struct {
+		Processor
+		processors []Processor
+	}
+
+	// annotated adds the `tag` and `description` options to the compiled
+	// processors. The tag is used as Logstash filter id and to derive the
+	// failure tags.
+	annotated struct {
+		Processor
+		tag, description string
+	}
+)
+
+// splitOptions separates the common options from the processor specific
+// settings.
+func splitOptions(config *common.Config) (*common.Config, map[string]interface{}, error) {
+	if config == nil {
+		return nil, nil, nil
+	}
+
+	fields := map[string]interface{}{}
+	if err := config.Unpack(&fields); err != nil {
+		return nil, nil, err
+	}
+
+	options := map[string]interface{}{}
+	for _, name := range optionNames {
+		if v, exists := fields[name]; exists {
+			options[name] = v
+			delete(fields, name)
+		}
+	}
+	if len(options) == 0 {
+		return config, nil, nil
+	}
+
+	params, err := common.NewConfigFrom(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return params, options, nil
+}
+
+// applyOptions wraps the processor with the common options. The processor is
+// guarded by `ignore_missing` first, such that `if` is evaluated last. If no
+// tag is configured, the tag is derived from the processor name and the
+// position of the processor in the pipeline.
+func applyOptions(ctx *LoadCtx, name string, p Processor, settings map[string]interface{}) (Processor, error) {
+	var opts Options
+	if d, ok := p.(OptionsDefaulter); ok {
+		opts = d.DefaultOptions()
+	}
+	if len(settings) > 0 {
+		cfg, err := common.NewConfigFrom(settings)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.Unpack(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.ID != "" && opts.Tag != "" {
+		return nil, errors.New("id and tag can not be used together")
+	}
+	if opts.ID != "" {
+		opts.Tag = opts.ID
+	}
+	if opts.Tag == "" {
+		opts.Tag = name
+		if ctx.path != "" {
+			opts.Tag += "_" + ctx.path
+		}
+	}
+
+	if v, ok := p.(OptionsValidator); ok {
+		if err := v.ValidateOptions(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if mp, ok := p.(IgnoreMissingProcessor); ok {
+		if opts.DropField {
+			return nil, errors.New("drop_field not supported")
+		}
+		p = mp.WithIgnoreMissing(opts.IgnoreMissing)
+	} else if opts.IgnoreMissing || opts.DropField {
+		var err error
+		if p, err = applyFieldOptions(p, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.IgnoreFailure && len(opts.OnFailure) > 0 {
+		return nil, errors.New("ignore_failure and on_failure can not be used together")
+	}
+	if opts.IgnoreFailure {
+		p = makeTryCatch(p, opts.Tag, nil)
+	}
+	if len(opts.OnFailure) > 0 {
+		handlers, err := LoadAll(ctx.Sub("on_failure"), opts.OnFailure)
+		if err != nil {
+			return nil, fmt.Errorf("on_failure: %v", err)
+		}
+		p = makeTryCatch(p, opts.Tag, handlers)
+	}
+
+	if opts.If != "" {
+		c, err := cond.Parse(opts.If)
+		if err != nil {
+			return nil, err
+		}
+		p = &conditional{Processor: p, cond: c}
+	}
+
+	return &annotated{Processor: p, tag: opts.Tag, description: opts.Description}, nil
+}
+
+// applyFieldOptions wraps the processor with the ignore_missing and drop_field
+// options. Processors with multiple source fields are split into one
+// processor per field.
+func applyFieldOptions(p Processor, opts Options) (Processor, error) {
+	if fp, ok := p.(FieldsProcessor); ok {
+		if split := fp.SplitFields(); len(split) > 0 {
+			for i, sub := range split {
+				var err error
+				if split[i], err = applyFieldOptions(sub, opts); err != nil {
+					return nil, err
+				}
+			}
+			return &fieldSplit{Processor: p, processors: split}, nil
+		}
+	}
+
+	fp, ok := p.(FieldProcessor)
+	if !ok || fp.SourceField() == "" {
+		return nil, errors.New("ignore_missing and drop_field not supported")
+	}
+
+	if opts.IgnoreMissing {
+		p = &fieldGuard{Processor: p, field: fp.SourceField()}
+	}
+	if opts.DropField {
+		p = &fieldDrop{Processor: p, field: fp.SourceField()}
+	}
+	return p, nil
+}
+
+// processorTag returns the processor tag. Processors without tag are
+// reported by the tag of the enclosing processor or by name.
+func processorTag(ctx *LogstashCtx, p Processor) string {
+	if a, ok := p.(*annotated); ok {
+		return a.tag
+	}
+	if ctx.tag != "" {
+		return ctx.tag
+	}
+	return p.Name()
+}
+
+// CompileIngest uses the processors ignore_missing setting if supported.
+// Otherwise the processors are guarded by a condition.
+func (g *fieldGuard) CompileIngest() ([]ingest.Processor, error) {
+	ps, err := g.Processor.CompileIngest()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ps) == 1 {
+		for name, params := range ps[0] {
+			if ingestIgnoreMissing[name] && params["field"] == g.field {
+				params["ignore_missing"] = true
+				return ps, nil
+			}
+		}
+	}
+
+	expr, err := cond.Has(g.field).CompileIngest()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", g.Name(), err)
+	}
+	for _, p := range ps {
+		addIngestCondition(p, expr)
+	}
+	return ps, nil
+}
+
+func (g *fieldGuard) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	blk, err := g.Processor.CompileLogstash(ctx)
+	if err != nil || len(blk.Block) == 0 {
+		return blk, err
+	}
+
+	blk.Block = ls.IgnoreMissing(g.field, blk.Block)
+	return blk, nil
+}
+
+func (g *fieldGuard) CompileLocal() ([]local.Processor, error) {
+	ps, err := g.Processor.CompileLocal()
+	if err != nil || len(ps) == 0 {
+		return ps, err
+	}
+
+	return local.Single(func(doc local.Document) error {
+		if _, ok, _ := doc.Field(g.field, true); !ok {
+			return nil
+		}
+		return local.Run(ps, doc)
+	}), nil
+}
+
+func (d *fieldDrop) CompileIngest() ([]ingest.Processor, error) {
+	ps, err := d.Processor.CompileIngest()
+	if err != nil {
+		return nil, err
+	}
+	return append(ps, ingest.RemoveField(d.field)), nil
+}
+
+// CompileLogstash removes the field only if none of the failure tags is set.
+func (d *fieldDrop) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	blk, err := d.Processor.CompileLogstash(ctx)
+	if err != nil {
+		return blk, err
+	}
+
+	params := ls.Params{}
+	params.RemoveField(d.field)
+	drop := ls.MakeBlock(ls.MakeFilter("mutate", params))
+	if cond := makeLSNoFailTagsCondition(blk.FailureTags); cond != "" && !ctx.DisableErrors {
+		drop = ls.MakeBlock(ls.Conditional{
+			Cond: []ls.Case{{Cond: ls.Expression(cond), Block: drop}},
+		})
+	}
+
+	blk.AppendBlock(drop)
+	return blk, nil
+}
+
+func (d *fieldDrop) CompileLocal() ([]local.Processor, error) {
+	ps, err := d.Processor.CompileLocal()
+	if err != nil {
+		return nil, err
+	}
+	return append(ps, local.RemoveField(d.field)), nil
+}
+
+func (s *fieldSplit) CompileIngest() ([]ingest.Processor, error) {
+	return CompileIngestProcessors(s.processors)
+}
+
+// CompileLogstash runs the processors in order. Like in Ingest Node, the
+// remaining processors are skipped if a processor fails.
+func (s *fieldSplit) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	blks := make([]FilterBlock, len(s.processors))
+	for i, p := range s.processors {
+		var err error
+		if blks[i], err = p.CompileLogstash(ctx); err != nil {
+			return FilterBlock{}, err
+		}
+	}
+
+	// nest the remaining processors bottom-up
+	var active ls.Block
+	for i := len(blks) - 1; i >= 0; i-- {
+		cond := makeLSNoFailTagsCondition(blks[i].FailureTags)
+		if len(active) > 0 && cond != "" && !ctx.DisableErrors {
+			active = ls.MakeBlock(ls.Conditional{
+				Cond: []ls.Case{{Cond: ls.Expression(cond), Block: active}},
+			})
+		}
+		active = append(ls.MakeBlock(blks[i].Block...), active...)
+	}
+
+	blk := FilterBlock{Block: active}
+	for _, sub := range blks {
+		blk.AddTags(sub.FailureTags...)
+	}
+	return blk, nil
+}
+
+func (s *fieldSplit) CompileLocal() ([]local.Processor, error) {
+	return CompileLocalProcessors(s.processors)
+}
+
+// Branches reports the processors as single branch, for the processors to be
+// checked in order.
+func (s *fieldSplit) Branches() []Branch {
+	return []Branch{{Name: "fields", Processors: s.processors}}
+}
+
+// CompileIngest sets the tag of all processors not tagged by nested
+// processors yet. The description is added to the processors using the tag.
+func (a *annotated) CompileIngest() ([]ingest.Processor, error) {
+	ps, err := a.Processor.CompileIngest()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range ps {
+		for _, params := range p {
+			if _, exists := params["tag"]; !exists {
+				params["tag"] = a.tag
+			}
+			if a.description != "" && params["tag"] == a.tag {
+				params["description"] = a.description
+			}
+		}
+	}
+	return ps, nil
+}
+
+// CompileLogstash derives the filter ids from the tag and adds the
+// description as comment.
+func (a *annotated) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	outer := ctx.tag
+	ctx.tag = a.tag
+	blk, err := a.Processor.CompileLogstash(ctx)
+	ctx.tag = outer
+	if err != nil || len(blk.Block) == 0 {
+		return blk, err
+	}
+
+	setLSFilterIDs(ctx, blk.Block, a.tag)
+	if a.description != "" {
+		blk.Block = append(ls.MakeBlock(ls.Comment(a.description)), blk.Block...)
+	}
+	return blk, nil
+}
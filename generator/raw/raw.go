@@ -0,0 +1,96 @@
+package raw
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// logstashFilter adds Logstash filter configuration text as is. It is used
+// for filters that can not be expressed using the available generators.
+type logstashFilter struct {
+	config logstashFilterConfig
+}
+
+type logstashFilterConfig struct {
+	Source string `validate:"required"`
+}
+
+// ingestProcessor passes an Ingest Node processor definition as is. It is used
+// for processors that can not be expressed using the available generators.
+type ingestProcessor struct {
+	processor ingest.Processor
+}
+
+func init() {
+	generator.Register("ingest_processor", makeIngestProcessor)
+	generator.Register("logstash_filter", makeLogstashFilter)
+}
+
+func makeIngestProcessor(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	definition := map[string]interface{}{}
+	if err := cfg.Unpack(&definition); err != nil {
+		return nil, err
+	}
+
+	if len(definition) != 1 {
+		return nil, errors.New("ingest_processor requires exactly one processor definition")
+	}
+
+	processor := ingest.Processor{}
+	for name, params := range definition {
+		m, ok := params.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid parameters for processor '%v'", name)
+		}
+		processor[name] = m
+	}
+
+	return &ingestProcessor{processor}, nil
+}
+
+func (p *ingestProcessor) Name() string { return "ingest_processor" }
+
+func (p *ingestProcessor) CompileIngest() ([]ingest.Processor, error) {
+	return ingest.Single(p.processor), nil
+}
+
+func (p *ingestProcessor) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	return generator.FilterBlock{}, errors.New("ingest_processor not supported on 'logstash' target")
+}
+
+func (p *ingestProcessor) CompileLocal() ([]local.Processor, error) {
+	return nil, errors.New("ingest_processor not supported on 'local' target")
+}
+
+func makeLogstashFilter(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := logstashFilterConfig{}
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	return &logstashFilter{config}, nil
+}
+
+func (f *logstashFilter) Name() string { return "logstash_filter" }
+
+func (f *logstashFilter) CompileIngest() ([]ingest.Processor, error) {
+	return nil, errors.New("logstash_filter not supported on 'ingest' target")
+}
+
+// failure tag: none, failures are handled by the configured filters
+func (f *logstashFilter) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	return generator.FilterBlock{
+		Block: ls.MakeVerboseBlock(ctx.Verbose, "logstash_filter", ls.Raw(f.config.Source)),
+	}, nil
+}
+
+func (f *logstashFilter) CompileLocal() ([]local.Processor, error) {
+	return nil, errors.New("logstash_filter not supported on 'local' target")
+}
@@ -9,7 +9,7 @@ import (
 
 var processors = map[string]Factory{}
 
-type Factory func(config *common.Config) (Processor, error)
+type Factory func(ctx *LoadCtx, config *common.Config) (Processor, error)
 
 func Register(name string, f Factory) {
 	if processors[name] != nil {
@@ -22,7 +22,7 @@ func Find(name string) Factory {
 	return processors[name]
 }
 
-func LoadAll(configs []*common.Config) ([]Processor, error) {
+func LoadAll(ctx *LoadCtx, configs []*common.Config) ([]Processor, error) {
 	if len(configs) == 0 {
 		return nil, nil
 	}
@@ -30,14 +30,14 @@ func LoadAll(configs []*common.Config) ([]Processor, error) {
 	ps := make([]Processor, len(configs))
 	for i, cfg := range configs {
 		var err error
-		if ps[i], err = Load(cfg); err != nil {
-			return nil, err
+		if ps[i], err = Load(ctx.at(i), cfg); err != nil {
+			return nil, fmt.Errorf("processor %v: %v", i, err)
 		}
 	}
 	return ps, nil
 }
 
-func Load(config *common.Config) (Processor, error) {
+func Load(ctx *LoadCtx, config *common.Config) (Processor, error) {
 	processor := map[string]*common.Config{}
 	err := config.Unpack(&processor)
 	if err != nil {
@@ -57,14 +57,28 @@ func Load(config *common.Config) (Processor, error) {
 		name, params = n, p
 	}
 
-	return LoadNamed(name, params)
+	return LoadNamed(ctx, name, params)
 }
 
-func LoadNamed(name string, config *common.Config) (Processor, error) {
+func LoadNamed(ctx *LoadCtx, name string, config *common.Config) (Processor, error) {
 	factory := Find(name)
 	if factory == nil {
 		return nil, fmt.Errorf("processor '%v' not available", name)
 	}
 
-	return factory(config)
+	params, options, err := splitOptions(config)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+
+	p, err := factory(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+
+	p, err = applyOptions(ctx, name, p, options)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	return p, nil
 }
@@ -1,8 +1,11 @@
 package remove
 
 import (
+	"fmt"
+
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -12,48 +15,52 @@ import (
 
 type remove struct {
 	config
+
+	// ignoreFailure is set by try_remove
+	ignoreFailure bool
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	IgnoreFailure bool   `config:"ignore_failure"`
+	Field string `validate:"required"`
 }
 
 func init() {
 	generator.Register("remove", makeRemove)
+	generator.RegisterIngestImport("remove", importIngest)
 	generator.Register("try_remove", makeTryRemove)
 }
 
-func makeRemove(cfg *common.Config) (generator.Processor, error) {
+func makeRemove(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
 	}
 
-	return &remove{config}, nil
+	return &remove{config: config}, nil
 }
 
-func makeTryRemove(cfg *common.Config) (generator.Processor, error) {
-	tryConfig := struct {
-		Field string `validate:"required"`
-	}{}
-	if err := cfg.Unpack(&tryConfig); err != nil {
+func makeTryRemove(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
 	}
 
-	return &remove{config{
-		Field:         tryConfig.Field,
-		IgnoreFailure: true,
-	}}, nil
+	return &remove{config: config, ignoreFailure: true}, nil
 }
 
 func (r *remove) Name() string { return "remove" }
 
+func (r *remove) SourceField() string { return r.Field }
+
+func (r *remove) Flow() (generator.Flow, error) {
+	return generator.Flow{Removes: []string{r.Field}}, nil
+}
+
 func (r *remove) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field": r.Field,
 	}
-	if r.IgnoreFailure {
+	if r.ignoreFailure {
 		params["ignore_failure"] = true
 	}
 
@@ -64,8 +71,8 @@ func (r *remove) CompileIngest() ([]ingest.Processor, error) {
 func (r *remove) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
 	var failureTag string
 
-	if !r.IgnoreFailure {
-		failureTag = ctx.CreateTag("_failure_remove")
+	if !r.ignoreFailure {
+		failureTag = ctx.CreateTag("_failure")
 	}
 
 	params := ls.Params{}
@@ -85,6 +92,25 @@ func (r *remove) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBl
 	}, nil
 }
 
+func (r *remove) CompileLocal() ([]local.Processor, error) {
+	return local.Single(func(doc local.Document) error {
+		if !doc.Delete(r.Field) && !r.ignoreFailure {
+			return fmt.Errorf("field [%v] not present as part of path [%v]", r.Field, r.Field)
+		}
+		return nil
+	}), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field": "field",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("remove", config), nil
+}
@@ -1,8 +1,13 @@
 package grok
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -13,17 +18,17 @@ type rename struct {
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	To            string `config:"target_field" validate:"required"`
-	IgnoreMissing bool   `config:"ignore_missing"`
-	IgnoreFailure bool   `config:"ignore_failure"`
+	Field string `validate:"required"`
+	To    string `config:"target_field" validate:"required"`
 }
 
 func init() {
 	generator.Register("rename", makeRename)
+	generator.RegisterIngestImport("rename", importIngest)
+	generator.RegisterLogstashImport("mutate.rename", importLogstash)
 }
 
-func makeRename(cfg *common.Config) (generator.Processor, error) {
+func makeRename(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -34,27 +39,32 @@ func makeRename(cfg *common.Config) (generator.Processor, error) {
 
 func (r *rename) Name() string { return "rename" }
 
+func (r *rename) SourceField() string { return r.Field }
+
+func (r *rename) Flow() (generator.Flow, error) {
+	return generator.Flow{
+		Reads:   []string{r.Field},
+		Writes:  []string{r.To},
+		Removes: []string{r.Field},
+	}, nil
+}
+
+// DefaultOptions enables ignore_missing by default.
+func (r *rename) DefaultOptions() generator.Options {
+	return generator.Options{IgnoreMissing: true}
+}
+
 func (r *rename) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field":        r.Field,
 		"target_field": r.To,
 	}
-	if r.IgnoreMissing {
-		params["ignore_missing"] = true
-	}
-	if r.IgnoreFailure {
-		params["ignore_failure"] = true
-	}
-
 	return ingest.MakeSingleProcessor("rename", params), nil
 }
 
 // failure tag: none, need to generate custom tag handling
 func (r *rename) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	var failureTag string
-	if !r.IgnoreFailure {
-		failureTag = ctx.CreateTag("_failure_rename")
-	}
+	failureTag := ctx.CreateTag("_failure")
 
 	mutate := ls.Params{
 		"rename": ls.Params{
@@ -70,6 +80,73 @@ func (r *rename) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBl
 	}, nil
 }
 
+func (r *rename) CompileLocal() ([]local.Processor, error) {
+	rename := func(doc local.Document) error {
+		value, exists := doc.Get(r.Field)
+		if !exists {
+			return fmt.Errorf("field [%v] doesn't exist", r.Field)
+		}
+
+		if doc.Has(r.To) {
+			return fmt.Errorf("field [%v] already exists", r.To)
+		}
+
+		doc.Delete(r.Field)
+		return doc.Put(r.To, value)
+	}
+
+	return local.Single(rename), nil
+}
+
 func defaultConfig() config {
-	return config{IgnoreMissing: true}
+	return config{}
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_field":   "target_field",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// ignore_missing is enabled by default
+	if _, exists := config["ignore_missing"]; !exists {
+		config["ignore_missing"] = false
+	}
+	return generator.MakeImport("rename", config), nil
+}
+
+// importLogstash creates a rename processor per field. Missing fields are
+// ignored, like in Logstash.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	fields, ok := params["rename"].(ls.Params)
+	if !ok {
+		return nil, errors.New("rename must be a hash")
+	}
+
+	var configs []map[string]interface{}
+	for _, from := range sortedKeys(fields) {
+		to, ok := fields[from].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid rename target for '%v'", from)
+		}
+
+		configs = append(configs, generator.MakeImport("rename", map[string]interface{}{
+			"field":        ls.FieldPath(from),
+			"target_field": ls.FieldPath(to),
+		}))
+	}
+	return configs, nil
+}
+
+func sortedKeys(m ls.Params) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -21,9 +22,10 @@ type config struct {
 
 func init() {
 	generator.Register("ruby", makeRuby)
+	generator.RegisterLogstashImport("ruby", importLogstash)
 }
 
-func makeRuby(cfg *common.Config) (generator.Processor, error) {
+func makeRuby(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -40,7 +42,7 @@ func (r *ruby) CompileIngest() ([]ingest.Processor, error) {
 
 // failure tag: config via `tag_on_exception` (default: `_rubyexception`)
 func (r *ruby) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	failureTag := ctx.CreateTag("_failure_ruby")
+	failureTag := ctx.CreateTag("_failure")
 	code := strings.Replace(r.Code, "\n", "; ", -1)
 
 	blk := generator.MakeRuby(ctx, code, failureTag, nil)
@@ -50,6 +52,27 @@ func (r *ruby) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBloc
 	}, nil
 }
 
+func (r *ruby) CompileLocal() ([]local.Processor, error) {
+	return nil, errors.New("ruby not supported on 'local' target")
+}
+
 func defaultConfig() config {
 	return config{}
 }
+
+// importLogstash maps inline ruby code. The processor is only available in
+// Logstash, so it is wrapped into a select processor.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"code": "code",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []map[string]interface{}{
+		generator.MakeImport("select", map[string]interface{}{
+			"logstash": []interface{}{generator.MakeImport("ruby", config)},
+		}),
+	}, nil
+}
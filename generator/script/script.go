@@ -2,10 +2,12 @@ package script
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 
 	"github.com/elastic/beats/libbeat/common"
 )
@@ -21,9 +23,10 @@ type config struct {
 
 func init() {
 	generator.Register("script", makeScript)
+	generator.RegisterIngestImport("script", importIngest)
 }
 
-func makeScript(cfg *common.Config) (generator.Processor, error) {
+func makeScript(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -57,6 +60,10 @@ func (s *script) CompileLogstash(_ *generator.LogstashCtx) (generator.FilterBloc
 	return generator.FilterBlock{}, errors.New("script not supported on 'logstash' target")
 }
 
+func (s *script) CompileLocal() ([]local.Processor, error) {
+	return nil, errors.New("script not supported on 'local' target")
+}
+
 func defaultConfig() config {
 	return config{}
 }
@@ -72,3 +79,22 @@ func (c *config) Validate() error {
 
 	return nil
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"lang":   "lang",
+		"source": "code",
+		"inline": "code",
+		"id":     "id",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if lang, exists := config["lang"]; exists && lang != "painless" {
+		return nil, fmt.Errorf("script language '%v' not supported", lang)
+	}
+	delete(config, "lang")
+
+	return generator.MakeImport("script", config), nil
+}
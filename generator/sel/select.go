@@ -3,6 +3,7 @@ package sel
 import (
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -11,44 +12,70 @@ import (
 type sel struct {
 	ingest   []generator.Processor
 	logstash []generator.Processor
+	local    []generator.Processor
 }
 
 type config struct {
 	Ingest   []*common.Config
 	Logstash []*common.Config
+
+	// Local configures the processors for the local target. The ingest
+	// processors are used if not set.
+	Local []*common.Config
 }
 
 func init() {
 	generator.Register("select", makeSelect)
 }
 
-func makeSelect(cfg *common.Config) (generator.Processor, error) {
+func makeSelect(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
 	}
 
-	ingest, err := generator.LoadAll(config.Ingest)
+	ingest, err := generator.LoadAll(ctx.Sub("ingest"), config.Ingest)
 	if err != nil {
 		return nil, err
 	}
 
-	logstash, err := generator.LoadAll(config.Logstash)
+	logstash, err := generator.LoadAll(ctx.Sub("logstash"), config.Logstash)
 	if err != nil {
 		return nil, err
 	}
 
-	return &sel{ingest: ingest, logstash: logstash}, nil
+	local := ingest
+	if config.Local != nil {
+		local, err = generator.LoadAll(ctx.Sub("local"), config.Local)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &sel{ingest: ingest, logstash: logstash, local: local}, nil
 }
 
 func (s *sel) Name() string { return "select" }
 
+// Branches returns the processors per target. The local processors are
+// included only if they differ from the ingest processors.
+func (t *sel) Branches() []generator.Branch {
+	branches := []generator.Branch{
+		{Name: "ingest", Processors: t.ingest},
+		{Name: "logstash", Processors: t.logstash},
+	}
+	if len(t.local) > 0 && (len(t.ingest) == 0 || t.local[0] != t.ingest[0]) {
+		branches = append(branches, generator.Branch{Name: "local", Processors: t.local})
+	}
+	return branches
+}
+
 func (t *sel) CompileIngest() ([]ingest.Processor, error) {
 	return generator.CompileIngestProcessors(t.ingest)
 }
 
 func (t *sel) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	failureTags := []string{ctx.CreateTag("_failure_select")}
+	failureTags := []string{ctx.CreateTag("_failure")}
 	reporter := generator.MakeLSErrorReporter(ctx)
 	onError := func(filter string, tags []string) generator.FilterBlock {
 		fb := reporter(filter, tags)
@@ -61,6 +88,10 @@ func (t *sel) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock
 	return generator.CompileLogstashProcessors(ctx, onError, t.logstash)
 }
 
+func (t *sel) CompileLocal() ([]local.Processor, error) {
+	return generator.CompileLocalProcessors(t.local)
+}
+
 func defaultConfig() config {
 	return config{}
 }
@@ -0,0 +1,240 @@
+package set
+
+import (
+	"errors"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type appender struct {
+	appendConfig
+	values []value
+}
+
+type appendConfig struct {
+	Field            string `validate:"required"`
+	Value            interface{}
+	IgnoreEmptyValue bool `config:"ignore_empty_value"`
+}
+
+func init() {
+	generator.Register("append", makeAppend)
+	generator.RegisterIngestImport("append", importIngestAppend)
+}
+
+func makeAppend(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := appendConfig{}
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	values, err := makeValues(config.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("missing value")
+	}
+	return &appender{appendConfig: config, values: values}, nil
+}
+
+func (a *appender) Name() string { return "append" }
+
+// Flow reports the field as written depending on the event, such that values
+// appended to before are not reported as overwritten.
+func (a *appender) Flow() (generator.Flow, error) {
+	flow := generator.Flow{MayWrite: []string{a.Field}}
+	seen := map[string]bool{}
+	for _, v := range a.values {
+		for _, field := range v.fields() {
+			if !seen[field] {
+				seen[field] = true
+				flow.Reads = append(flow.Reads, field)
+			}
+		}
+	}
+	return flow, nil
+}
+
+// CompileIngest creates a processor per value if empty values are ignored, as
+// not supported by the append processor.
+func (a *appender) CompileIngest() ([]ingest.Processor, error) {
+	if !a.IgnoreEmptyValue {
+		return ingest.MakeSingleProcessor("append", map[string]interface{}{
+			"field": a.Field,
+			"value": a.ingestValue(),
+		}), nil
+	}
+
+	var ps []ingest.Processor
+	for _, v := range a.values {
+		if v.isEmpty() {
+			continue
+		}
+
+		params := map[string]interface{}{
+			"field": a.Field,
+			"value": v.ingest(),
+		}
+		if c := v.notEmpty(); c != nil {
+			expr, err := c.CompileIngest()
+			if err != nil {
+				return nil, err
+			}
+			params["if"] = expr
+		}
+		ps = append(ps, ingest.MakeProcessor("append", params))
+	}
+	return ps, nil
+}
+
+func (a *appender) ingestValue() interface{} {
+	if _, isList := a.Value.([]interface{}); !isList {
+		return a.values[0].ingest()
+	}
+
+	list := make([]interface{}, len(a.values))
+	for i, v := range a.values {
+		list[i] = v.ingest()
+	}
+	return list
+}
+
+// CompileLogstash collects the values in a temporary field using add_field,
+// and merges the temporary field into the target field. Constants are
+// converted to their original type, requiring all values to be of the same
+// type. Templates are rendered into temporary fields first, such that missing
+// fields are rendered as empty strings.
+//
+// failure tag: none, need to generate custom tag handling
+func (a *appender) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	var typ string
+	for i, v := range a.values {
+		_, t := v.logstash()
+		if i > 0 && t != typ {
+			return generator.FilterBlock{}, errors.New("values of different types not supported by Logstash")
+		}
+		typ = t
+	}
+
+	tmp := "@metadata." + ctx.CreateTag("_append")
+	failureTag := ctx.CreateTag("_failure")
+
+	var (
+		blk         ls.Block
+		formats     []string
+		rendered    []string
+		conditional bool
+	)
+	addField := func(formats []string) ls.Filter {
+		return ls.MakeFilter("mutate", ls.Params{
+			"add_field": ls.Params{ls.NormalizeField(tmp): formats},
+		})
+	}
+	for _, v := range a.values {
+		if a.IgnoreEmptyValue && v.isEmpty() {
+			continue
+		}
+
+		render, format, field := v.logstashRender(ctx, "_value")
+		if field != "" {
+			rendered = append(rendered, field)
+		}
+
+		c := v.notEmpty()
+		if !a.IgnoreEmptyValue || c == nil {
+			blk = append(blk, render...)
+			formats = append(formats, format)
+			continue
+		}
+
+		if len(formats) > 0 {
+			blk = append(blk, addField(formats))
+			formats = nil
+		}
+
+		expr, err := c.CompileLogstash()
+		if err != nil {
+			return generator.FilterBlock{}, err
+		}
+		blk = append(blk, ls.Conditional{
+			Cond: []ls.Case{{Cond: expr, Block: append(render, addField([]string{format}))}},
+		})
+		conditional = true
+	}
+	if len(formats) > 0 {
+		blk = append(blk, addField(formats))
+	}
+	if len(blk) == 0 {
+		// all values are ignored
+		return generator.FilterBlock{}, nil
+	}
+
+	params := ls.Params{
+		"merge": ls.Params{ls.NormalizeField(a.Field): ls.NormalizeField(tmp)},
+	}
+	if typ != "" {
+		params["convert"] = ls.Params{ls.NormalizeField(tmp): typ}
+	}
+	params.RemoveField(tmp)
+	for _, field := range rendered {
+		params.RemoveField(field)
+	}
+	params.RemoveTag(failureTag)
+
+	merge := ls.RunWithTags(ls.MakeBlock(ls.MakeFilter("mutate", params)), failureTag)
+	if conditional {
+		merge = ls.IgnoreMissing(tmp, merge)
+	}
+	blk = append(blk, merge...)
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "append", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (a *appender) CompileLocal() ([]local.Processor, error) {
+	add := func(doc local.Document) error {
+		var values []interface{}
+		for _, v := range a.values {
+			value := v.render(doc)
+			if a.IgnoreEmptyValue && value == "" {
+				continue
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+
+		old, exists := doc.Get(a.Field)
+		switch old := old.(type) {
+		case []interface{}:
+			values = append(old, values...)
+		default:
+			if exists {
+				values = append([]interface{}{old}, values...)
+			}
+		}
+		return doc.Put(a.Field, values)
+	}
+
+	return local.Single(add), nil
+}
+
+func importIngestAppend(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field": "field",
+		"value": "value",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("append", config), nil
+}
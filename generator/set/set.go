@@ -0,0 +1,197 @@
+package set
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/cond"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+	"github.com/urso/bpb/prog/template"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+type set struct {
+	config
+	value value
+}
+
+type config struct {
+	Field            string `validate:"required"`
+	Value            interface{}
+	Override         bool
+	IgnoreEmptyValue bool `config:"ignore_empty_value"`
+}
+
+func init() {
+	generator.Register("set", makeSet)
+	generator.RegisterIngestImport("set", importIngest)
+	generator.RegisterLogstashImport("mutate.replace", importLogstash)
+}
+
+func makeSet(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	value, err := makeValue(config.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &set{config: config, value: value}, nil
+}
+
+func (s *set) Name() string { return "set" }
+
+func (s *set) Flow() (generator.Flow, error) {
+	flow := generator.Flow{Reads: s.value.fields()}
+	if s.Override && !(s.IgnoreEmptyValue && s.value.mayBeEmpty()) {
+		flow.Writes = []string{s.Field}
+	} else {
+		flow.MayWrite = []string{s.Field}
+	}
+	return flow, nil
+}
+
+func (s *set) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"field": s.Field,
+		"value": s.value.ingest(),
+	}
+	if !s.Override {
+		params["override"] = false
+	}
+	if s.IgnoreEmptyValue {
+		params["ignore_empty_value"] = true
+	}
+	return ingest.MakeSingleProcessor("set", params), nil
+}
+
+// CompileLogstash uses mutate replace, as add_field turns existing fields into
+// arrays. Constants are converted to their original type. Templates are
+// rendered into a temporary field first, such that missing fields are
+// rendered as empty strings.
+//
+// failure tag: none, need to generate custom tag handling
+func (s *set) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	if s.IgnoreEmptyValue && s.value.isEmpty() {
+		return generator.FilterBlock{}, nil
+	}
+
+	failureTag := ctx.CreateTag("_failure")
+
+	render, format, tmp := s.value.logstashRender(ctx, "_value")
+	_, typ := s.value.logstash()
+
+	field := ls.NormalizeField(s.Field)
+	params := ls.Params{
+		"replace": ls.Params{field: format},
+	}
+	if typ != "" {
+		params["convert"] = ls.Params{field: typ}
+	}
+	if tmp != "" {
+		params.RemoveField(tmp)
+	}
+	params.RemoveTag(failureTag)
+
+	blk := ls.RunWithTags(append(render, ls.MakeFilter("mutate", params)), failureTag)
+
+	var checks []*cond.Cond
+	if !s.Override {
+		checks = append(checks, cond.Not(cond.Has(s.Field)))
+	}
+	if s.IgnoreEmptyValue {
+		if c := s.value.notEmpty(); c != nil {
+			checks = append(checks, c)
+		}
+	}
+	if len(checks) > 0 {
+		expr, err := cond.And(checks...).CompileLogstash()
+		if err != nil {
+			return generator.FilterBlock{}, err
+		}
+		blk = ls.MakeBlock(ls.Conditional{
+			Cond: []ls.Case{{Cond: expr, Block: blk}},
+		})
+	}
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "set", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (s *set) CompileLocal() ([]local.Processor, error) {
+	set := func(doc local.Document) error {
+		if !s.Override {
+			if _, exists, _ := doc.Field(s.Field, true); exists {
+				return nil
+			}
+		}
+
+		v := s.value.render(doc)
+		if s.IgnoreEmptyValue && v == "" {
+			return nil
+		}
+		return doc.Put(s.Field, v)
+	}
+
+	return local.Single(set), nil
+}
+
+func defaultConfig() config {
+	return config{Override: true}
+}
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":              "field",
+		"value":              "value",
+		"override":           "override",
+		"ignore_empty_value": "ignore_empty_value",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("set", config), nil
+}
+
+// importLogstash creates a set processor per field. Field references in the
+// values are converted into templates.
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	fields, ok := params["replace"].(ls.Params)
+	if !ok {
+		return nil, errors.New("replace must be a hash")
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var configs []map[string]interface{}
+	for _, name := range names {
+		format, ok := fields[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid replace value for '%v'", name)
+		}
+
+		tmpl, err := template.FromLogstash(format)
+		if err != nil {
+			return nil, err
+		}
+
+		configs = append(configs, generator.MakeImport("set", map[string]interface{}{
+			"field": ls.FieldPath(name),
+			"value": tmpl.String(),
+		}))
+	}
+	return configs, nil
+}
@@ -0,0 +1,137 @@
+package set
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/cond"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+	"github.com/urso/bpb/prog/template"
+)
+
+// value is a string template or a constant number or boolean.
+type value struct {
+	tmpl     *template.Template
+	constant interface{}
+}
+
+func makeValue(v interface{}) (value, error) {
+	switch v := v.(type) {
+	case string:
+		tmpl, err := template.Parse(v)
+		if err != nil {
+			return value{}, err
+		}
+		return value{tmpl: tmpl}, nil
+	case bool, int, int64, uint, uint64, float32, float64:
+		return value{constant: v}, nil
+	case nil:
+		return value{}, fmt.Errorf("missing value")
+	default:
+		return value{}, fmt.Errorf("value of type %T not supported", v)
+	}
+}
+
+func makeValues(v interface{}) ([]value, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+
+	values := make([]value, len(list))
+	for i, elem := range list {
+		var err error
+		if values[i], err = makeValue(elem); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (v value) fields() []string {
+	if v.tmpl == nil {
+		return nil
+	}
+	return v.tmpl.Fields()
+}
+
+// mayBeEmpty checks the value might be rendered as the empty string.
+func (v value) mayBeEmpty() bool {
+	return v.tmpl != nil && v.tmpl.MayBeEmpty()
+}
+
+// isEmpty checks the value is always the empty string.
+func (v value) isEmpty() bool {
+	return v.tmpl != nil && v.tmpl.IsConstant() && v.tmpl.MayBeEmpty()
+}
+
+// notEmpty creates the condition checking the rendered value is not the empty
+// string. Returns nil if the value is never empty.
+func (v value) notEmpty() *cond.Cond {
+	if !v.mayBeEmpty() {
+		return nil
+	}
+
+	var cs []*cond.Cond
+	for _, field := range v.tmpl.Fields() {
+		cs = append(cs, cond.NotEmpty(field))
+	}
+	return cond.Or(cs...)
+}
+
+func (v value) ingest() interface{} {
+	if v.tmpl != nil {
+		return v.tmpl.CompileIngest()
+	}
+	return v.constant
+}
+
+// logstash returns the sprintf format and the mutate convert type required to
+// restore the type of constants.
+func (v value) logstash() (format, typ string) {
+	switch c := v.constant.(type) {
+	case nil:
+		return v.tmpl.CompileLogstash(), ""
+	case bool:
+		return fmt.Sprint(c), "boolean"
+	case float32, float64:
+		return local.ToString(c), "float"
+	default:
+		return fmt.Sprint(c), "integer"
+	}
+}
+
+// logstashRender creates a ruby filter rendering the template into a
+// temporary field, and returns the format reading the rendered value and the
+// temporary field. References to missing fields are removed before rendering,
+// as sprintf keeps them as is, while mustache renders them as empty strings.
+// Values without field references are not rendered.
+func (v value) logstashRender(ctx *generator.LogstashCtx, name string) (render ls.Block, format, tmp string) {
+	format, _ = v.logstash()
+	fields := v.fields()
+	if len(fields) == 0 {
+		return nil, format, ""
+	}
+
+	tmp = "@metadata." + ctx.CreateTag(name)
+	refs := make([]string, len(fields))
+	for i, field := range fields {
+		refs[i] = generator.RubyString(ls.NormalizeField(field))
+	}
+	code := strings.Join([]string{
+		"f = " + generator.RubyString(format),
+		fmt.Sprintf("[%v].each { |r| f = f.gsub('%%{' + r + '}', '') if event.get(r).nil? }", strings.Join(refs, ", ")),
+		fmt.Sprintf("event.set('%v', event.sprintf(f))", ls.NormalizeField(tmp)),
+	}, "; ")
+	render = ls.MakeBlock(ls.MakeFilter("ruby", ls.Params{"code": code}))
+	return render, "%{" + ls.NormalizeField(tmp) + "}", tmp
+}
+
+func (v value) render(doc local.Document) interface{} {
+	if v.tmpl != nil {
+		return v.tmpl.Render(doc)
+	}
+	return v.constant
+}
@@ -3,10 +3,12 @@ package split
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -21,14 +23,14 @@ type config struct {
 	Separator string
 	Regex     string
 	To        string `config:"target_field"`
-	DropField bool   `config:"drop_field"`
 }
 
 func init() {
 	generator.Register("split_by", makeSplit)
+	generator.RegisterIngestImport("split", importIngest)
 }
 
-func makeSplit(cfg *common.Config) (generator.Processor, error) {
+func makeSplit(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -39,19 +41,21 @@ func makeSplit(cfg *common.Config) (generator.Processor, error) {
 
 func (s *split) Name() string { return "split" }
 
-func (s *split) CompileIngest() ([]ingest.Processor, error) {
-	var split ingest.Processor
-	if s.Regex != "" {
-		split = s.compileIngestRegex()
-	} else {
-		split = s.compileIngestSeparator()
+func (s *split) SourceField() string { return s.Field }
+
+func (s *split) Flow() (generator.Flow, error) {
+	to := s.To
+	if to == "" {
+		to = s.Field
 	}
+	return generator.Flow{Reads: []string{s.Field}, Writes: []string{to}}, nil
+}
 
-	ps := ingest.Single(split)
-	if s.DropField {
-		ps = append(ps, ingest.RemoveField(s.Field))
+func (s *split) CompileIngest() ([]ingest.Processor, error) {
+	if s.Regex != "" {
+		return ingest.Single(s.compileIngestRegex()), nil
 	}
-	return ps, nil
+	return ingest.Single(s.compileIngestSeparator()), nil
 }
 
 func (s *split) compileIngestRegex() ingest.Processor {
@@ -80,7 +84,7 @@ func (s *split) compileIngestSeparator() ingest.Processor {
 }
 
 func (s *split) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	failureTag := ctx.CreateTag("_failure_split")
+	failureTag := ctx.CreateTag("_failure")
 
 	var split ls.Block
 	if s.Regex != "" {
@@ -105,10 +109,7 @@ func (s *split) compileLogstashRegex(ctx *generator.LogstashCtx, failureTag stri
 	target = ls.NormalizeField(target)
 
 	code := fmt.Sprintf(`event.set('%v', event.get('%v').split(/%v/))`, target, source, s.Regex)
-
-	params := ls.Params{}
-	params.DropField(s.DropField, s.Field)
-	return generator.MakeRuby(ctx, code, failureTag, params)
+	return generator.MakeRuby(ctx, code, failureTag, nil)
 }
 
 // failure tag: not configurable... potentially multiple (_split_type_failure and on exception?)
@@ -117,7 +118,6 @@ func (s *split) compileLogstashSeparator(failureTag string) ls.Block {
 	if s.To != "" {
 		params.Target(s.To)
 	}
-	params.DropField(s.DropField, s.Field)
 	params.RemoveTag(failureTag)
 
 	blk := ls.MakeBlock(ls.MakeFilter("split", params))
@@ -125,6 +125,38 @@ func (s *split) compileLogstashSeparator(failureTag string) ls.Block {
 	return blk
 }
 
+func (s *split) CompileLocal() ([]local.Processor, error) {
+	pattern := s.Regex
+	if pattern == "" {
+		pattern = regexp.QuoteMeta(s.Separator)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	to := s.To
+	if to == "" {
+		to = s.Field
+	}
+
+	split := func(doc local.Document) error {
+		value, _, err := doc.StringField(s.Field, false)
+		if err != nil {
+			return err
+		}
+
+		var list []interface{}
+		for _, part := range local.SplitRegex(re, value) {
+			list = append(list, part)
+		}
+		return doc.Put(to, list)
+	}
+
+	return local.Single(split), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
@@ -140,3 +172,15 @@ func (c *config) Validate() error {
 
 	return nil
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":        "field",
+		"separator":    "regex",
+		"target_field": "target_field",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("split_by", config), nil
+}
@@ -0,0 +1,181 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+)
+
+// tryCatch runs the on_failure processors if the processor fails. It is
+// configured via the common `on_failure` option. Without handlers, failures
+// are ignored, as configured via the `ignore_failure` option.
+type tryCatch struct {
+	Processor
+	tag       string
+	onFailure []Processor
+}
+
+func makeTryCatch(p Processor, tag string, onFailure []Processor) *tryCatch {
+	return &tryCatch{Processor: p, tag: tag, onFailure: onFailure}
+}
+
+// CompileIngest uses the Ingest Node ignore_failure setting if the processor
+// compiles to a single ingest processor and no handlers are configured.
+// Handlers are added via the on_failure setting. If the processor compiles to
+// multiple ingest processors, failures are recorded in a marker field, such
+// that the remaining processors are skipped and the handlers are run. The
+// marker is removed after the handlers, or if a handler fails.
+func (t *tryCatch) CompileIngest() ([]ingest.Processor, error) {
+	ps, err := t.Processor.CompileIngest()
+	if err != nil || len(ps) == 0 {
+		return ps, err
+	}
+
+	if len(ps) == 1 && len(t.onFailure) == 0 {
+		for _, params := range ps[0] {
+			params["ignore_failure"] = true
+		}
+		return ps, nil
+	}
+
+	handlers, err := CompileIngestProcessors(t.onFailure)
+	if err != nil {
+		return nil, fmt.Errorf("on_failure: %v", err)
+	}
+
+	if len(ps) == 1 && !hasIngestOnFailure(ps[0]) {
+		for _, params := range ps[0] {
+			params["on_failure"] = handlers
+		}
+		return ps, nil
+	}
+
+	marker := "_failure_" + markerName(t.tag)
+	setMarker := ingest.MakeSingleProcessor("set", map[string]interface{}{
+		"field": marker,
+		"value": "{{ _ingest.on_failure_message }}",
+	})
+	for _, p := range ps {
+		addIngestCondition(p, fmt.Sprintf("ctx.%v == null", marker))
+		if !hasIngestOnFailure(p) {
+			for _, params := range p {
+				params["on_failure"] = setMarker
+			}
+		}
+	}
+	failHandler := []ingest.Processor{
+		ingest.RemoveField(marker),
+		ingest.MakeProcessor("fail", map[string]interface{}{
+			"message": "{{ _ingest.on_failure_message }}",
+		}),
+	}
+	for _, p := range handlers {
+		addIngestCondition(p, fmt.Sprintf("ctx.%v != null", marker))
+		if !hasIngestOnFailure(p) && !hasIngestIgnoreFailure(p) {
+			for _, params := range p {
+				params["on_failure"] = failHandler
+			}
+		}
+	}
+
+	ps = append(ps, handlers...)
+	return append(ps, ingest.RemoveField(marker)), nil
+}
+
+// CompileLogstash tags failures of the processor and runs the handlers if the
+// tag is set. Failures in the handlers are passed on to the enclosing block.
+func (t *tryCatch) CompileLogstash(ctx *LogstashCtx) (FilterBlock, error) {
+	// errors reported by nested processors only set the caught tag
+	caughtTag := ctx.CreateTag("_on_failure")
+	outerTag := ctx.failureTag
+	ctx.failureTag = caughtTag
+	reporter := MakeLSErrorReporter(ctx)
+	caught := false
+	catch := func(filter string, tags []string) FilterBlock {
+		caught = true
+		return reporter(filter, tags)
+	}
+	blk, err := CompileLogstashProcessors(ctx, catch, []Processor{t.Processor})
+	ctx.failureTag = outerTag
+	if err != nil || !caught {
+		return blk, err
+	}
+
+	failureTag := ctx.CreateTag("_failure_on_failure")
+	onError := func(string, []string) FilterBlock {
+		return FilterBlock{
+			Block: ls.MakeBlock(ls.MakeFilter("mutate", ls.Params{
+				"add_tag": []string{failureTag},
+			})),
+			FailureTags: []string{failureTag},
+		}
+	}
+
+	handlers, err := CompileLogstashProcessors(ctx, onError, t.onFailure)
+	if err != nil {
+		return FilterBlock{}, fmt.Errorf("on_failure: %v", err)
+	}
+
+	params := ls.Params{}
+	params.RemoveTag(caughtTag)
+	onFailure := append(ls.MakeBlock(ls.MakeFilter("mutate", params)), handlers.Block...)
+
+	blk.AppendBlock(ls.MakeBlock(ls.Conditional{
+		Cond: []ls.Case{
+			{
+				Cond:  ls.Expression(fmt.Sprintf(`"%v" in [tags]`, caughtTag)),
+				Block: onFailure,
+			},
+		},
+	}))
+	blk.FailureTags = handlers.FailureTags
+	return blk, nil
+}
+
+func (t *tryCatch) CompileLocal() ([]local.Processor, error) {
+	ps, err := t.Processor.CompileLocal()
+	if err != nil {
+		return nil, err
+	}
+
+	handlers, err := CompileLocalProcessors(t.onFailure)
+	if err != nil {
+		return nil, fmt.Errorf("on_failure: %v", err)
+	}
+
+	return local.Single(local.Try(ps, handlers)), nil
+}
+
+// markerName replaces all characters not valid in painless identifiers, such
+// that the marker field can be accessed in conditions.
+func markerName(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, tag)
+}
+
+func hasIngestIgnoreFailure(p ingest.Processor) bool {
+	for _, params := range p {
+		if ignore, _ := params["ignore_failure"].(bool); ignore {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIngestOnFailure(p ingest.Processor) bool {
+	for _, params := range p {
+		if _, exists := params["on_failure"]; exists {
+			return true
+		}
+	}
+	return false
+}
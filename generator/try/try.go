@@ -0,0 +1,72 @@
+package try
+
+import (
+	"errors"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// try groups processors, such that the handlers configured via the common
+// `on_failure` setting are shared by all processors in the group. If a
+// processor fails, the remaining processors in the group are skipped.
+type try struct {
+	processors []generator.Processor
+}
+
+type config struct {
+	Processors []*common.Config `validate:"required"`
+}
+
+func init() {
+	generator.Register("try", makeTry)
+}
+
+func makeTry(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	processors, err := generator.LoadAll(ctx, config.Processors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &try{processors: processors}, nil
+}
+
+func (t *try) Name() string { return "try" }
+
+func (t *try) ValidateOptions(opts generator.Options) error {
+	if len(opts.OnFailure) == 0 {
+		return errors.New("try requires on_failure")
+	}
+	return nil
+}
+
+func (t *try) Branches() []generator.Branch {
+	return []generator.Branch{{Name: "processors", Processors: t.processors}}
+}
+
+func (t *try) CompileIngest() ([]ingest.Processor, error) {
+	return generator.CompileIngestProcessors(t.processors)
+}
+
+// CompileLogstash reports failures via the error reporter only. The group is
+// always wrapped by the on_failure handler, which configures the reporter to
+// tag the event for the handler.
+func (t *try) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	return generator.CompileLogstashProcessors(ctx, generator.MakeLSErrorReporter(ctx), t.processors)
+}
+
+func (t *try) CompileLocal() ([]local.Processor, error) {
+	return generator.CompileLocalProcessors(t.processors)
+}
+
+func defaultConfig() config {
+	return config{}
+}
@@ -0,0 +1,211 @@
+package uri
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// uriParts splits a URI into the ECS url fields domain, extension, fragment,
+// path, port, query, scheme, user_info, username and password. Like
+// java.net.URI, path, query, fragment and user info are percent-decoded and
+// the port is only reported if present in the URI.
+type uriParts struct {
+	uriPartsConfig
+}
+
+type uriPartsConfig struct {
+	Field              string `validate:"required"`
+	To                 string `config:"target_field"`
+	KeepOriginal       bool   `config:"keep_original"`
+	RemoveIfSuccessful bool   `config:"remove_if_successful"`
+}
+
+// rubyURIParts creates the url fields from the components returned by
+// URI.split. URI.parse is not used, as it sets the default port of the scheme
+// if the URI has no port.
+const rubyURIParts = `p = URI.split(v); u = URI::RFC2396_Parser.new; r = {}; ` +
+	`r['domain'] = p[2] if p[2]; ` +
+	`r['fragment'] = u.unescape(p[8]) if p[8]; ` +
+	`if p[5] && p[6].nil?; path = u.unescape(p[5]); r['path'] = path; i = path.rindex('.'); r['extension'] = path[i+1..-1] if i; end; ` +
+	`r['port'] = p[3].to_i if p[3] && !p[3].empty?; ` +
+	`r['query'] = u.unescape(p[7]) if p[7]; ` +
+	`r['scheme'] = p[0]; ` +
+	`if p[1]; ui = u.unescape(p[1]); r['user_info'] = ui; i = ui.index(':'); if i; r['username'] = ui[0...i]; r['password'] = ui[i+1..-1]; end; end`
+
+func init() {
+	generator.Register("uri_parts", makeURIParts)
+	generator.RegisterIngestImport("uri_parts", importIngestURIParts)
+}
+
+func makeURIParts(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := defaultURIPartsConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	return &uriParts{config}, nil
+}
+
+func defaultURIPartsConfig() uriPartsConfig {
+	return uriPartsConfig{To: "url", KeepOriginal: true}
+}
+
+func (u *uriParts) Name() string { return "uri_parts" }
+
+func (u *uriParts) SourceField() string { return u.Field }
+
+func (u *uriParts) Flow() (generator.Flow, error) {
+	flow := generator.Flow{Reads: []string{u.Field}, Writes: []string{u.To}}
+	if u.removeSource() {
+		flow.Removes = []string{u.Field}
+	}
+	return flow, nil
+}
+
+// removeSource checks the source field is removed. Like in Ingest Node, the
+// source field is kept if it is the target field.
+func (u *uriParts) removeSource() bool {
+	return u.RemoveIfSuccessful && u.Field != u.To
+}
+
+func (u *uriParts) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"field":        u.Field,
+		"target_field": u.To,
+	}
+	if !u.KeepOriginal {
+		params["keep_original"] = false
+	}
+	if u.RemoveIfSuccessful {
+		params["remove_if_successful"] = true
+	}
+	return ingest.MakeSingleProcessor("uri_parts", params), nil
+}
+
+// failure tag: none, need to generate custom tag handling
+func (u *uriParts) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	code := []string{
+		fmt.Sprintf("v = event.get('%v')", ls.NormalizeField(u.Field)),
+		rubyURIParts,
+	}
+	if u.KeepOriginal {
+		code = append(code, "r['original'] = v")
+	}
+	code = append(code, fmt.Sprintf("event.set('%v', r)", ls.NormalizeField(u.To)))
+	if u.removeSource() {
+		code = append(code, fmt.Sprintf("event.remove('%v')", ls.NormalizeField(u.Field)))
+	}
+
+	blk := generator.MakeRuby(ctx, strings.Join(code, "; "), failureTag, ls.Params{"init": "require 'uri'"})
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "uri_parts", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (u *uriParts) CompileLocal() ([]local.Processor, error) {
+	split := func(doc local.Document) error {
+		value, _, err := doc.StringField(u.Field, false)
+		if err != nil {
+			return err
+		}
+
+		parts, err := splitURI(value)
+		if err != nil {
+			return err
+		}
+		if u.KeepOriginal {
+			parts["original"] = value
+		}
+
+		if err := doc.Put(u.To, parts); err != nil {
+			return err
+		}
+		if u.removeSource() {
+			doc.Delete(u.Field)
+		}
+		return nil
+	}
+
+	return local.Single(split), nil
+}
+
+func splitURI(s string) (map[string]interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := map[string]interface{}{}
+	if host := u.Hostname(); host != "" {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		parts["domain"] = host
+	}
+	if strings.Contains(s, "#") {
+		parts["fragment"] = u.Fragment
+	}
+	if u.Opaque == "" {
+		parts["path"] = u.Path
+		if i := strings.LastIndexByte(u.Path, '.'); i >= 0 {
+			parts["extension"] = u.Path[i+1:]
+		}
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%v'", port)
+		}
+		parts["port"] = n
+	}
+	if u.RawQuery != "" || u.ForceQuery {
+		query, err := url.PathUnescape(u.RawQuery)
+		if err != nil {
+			return nil, err
+		}
+		parts["query"] = query
+	}
+
+	// url.Parse converts the scheme to lower case
+	parts["scheme"] = nil
+	if u.Scheme != "" {
+		parts["scheme"] = s[:len(u.Scheme)]
+	}
+
+	if u.User != nil {
+		userInfo := u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			parts["username"] = userInfo
+			parts["password"] = password
+			userInfo += ":" + password
+		}
+		parts["user_info"] = userInfo
+	}
+	return parts, nil
+}
+
+func importIngestURIParts(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":                "field",
+		"target_field":         "target_field",
+		"keep_original":        "keep_original",
+		"remove_if_successful": "remove_if_successful",
+		"ignore_missing":       "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("uri_parts", config), nil
+}
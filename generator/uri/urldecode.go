@@ -0,0 +1,109 @@
+package uri
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+
+	"github.com/elastic/beats/libbeat/common"
+)
+
+// urldecode decodes form encoded strings. Like java.net.URLDecoder, `+` is
+// decoded as space.
+type urldecode struct {
+	urldecodeConfig
+}
+
+type urldecodeConfig struct {
+	Field string `validate:"required"`
+	To    string `config:"target_field"`
+}
+
+func init() {
+	generator.Register("urldecode", makeURLDecode)
+	generator.RegisterIngestImport("urldecode", importIngestURLDecode)
+}
+
+func makeURLDecode(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
+	config := urldecodeConfig{}
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	return &urldecode{config}, nil
+}
+
+func (u *urldecode) Name() string { return "urldecode" }
+
+func (u *urldecode) SourceField() string { return u.Field }
+
+func (u *urldecode) Flow() (generator.Flow, error) {
+	return generator.Flow{Reads: []string{u.Field}, Writes: []string{u.target()}}, nil
+}
+
+func (u *urldecode) target() string {
+	if u.To != "" {
+		return u.To
+	}
+	return u.Field
+}
+
+func (u *urldecode) CompileIngest() ([]ingest.Processor, error) {
+	params := map[string]interface{}{
+		"field": u.Field,
+	}
+	if u.To != "" {
+		params["target_field"] = u.To
+	}
+	return ingest.MakeSingleProcessor("urldecode", params), nil
+}
+
+// CompileLogstash generates a ruby filter, as the urldecode filter does not
+// decode `+` as space.
+//
+// failure tag: none, need to generate custom tag handling
+func (u *urldecode) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
+	failureTag := ctx.CreateTag("_failure")
+
+	code := fmt.Sprintf("event.set('%v', URI.decode_www_form_component(event.get('%v')))",
+		ls.NormalizeField(u.target()), ls.NormalizeField(u.Field))
+	blk := generator.MakeRuby(ctx, code, failureTag, ls.Params{"init": "require 'uri'"})
+
+	return generator.FilterBlock{
+		Block:       ls.MakeVerboseBlock(ctx.Verbose, "urldecode", blk...),
+		FailureTags: []string{failureTag},
+	}, nil
+}
+
+func (u *urldecode) CompileLocal() ([]local.Processor, error) {
+	decode := func(doc local.Document) error {
+		value, _, err := doc.StringField(u.Field, false)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			return err
+		}
+		return doc.Put(u.target(), decoded)
+	}
+
+	return local.Single(decode), nil
+}
+
+func importIngestURLDecode(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":          "field",
+		"target_field":   "target_field",
+		"ignore_missing": "ignore_missing",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("urldecode", config), nil
+}
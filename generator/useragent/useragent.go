@@ -1,8 +1,12 @@
 package useragent
 
 import (
+	"errors"
+
 	"github.com/urso/bpb/generator"
 	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/local"
+	uaparser "github.com/urso/bpb/prog/local/useragent"
 	"github.com/urso/bpb/prog/ls"
 
 	"github.com/elastic/beats/libbeat/common"
@@ -13,17 +17,17 @@ type useragent struct {
 }
 
 type config struct {
-	Field         string `validate:"required"`
-	To            string `config:"target_field"`
-	DropField     bool   `config:"drop_field"`
-	IgnoreFailure bool   `config:"ignore_failure"`
+	Field string `validate:"required"`
+	To    string `config:"target_field"`
 }
 
 func init() {
 	generator.Register("user_agent", makeUserAgent)
+	generator.RegisterIngestImport("user_agent", importIngest)
+	generator.RegisterLogstashImport("useragent", importLogstash)
 }
 
-func makeUserAgent(cfg *common.Config) (generator.Processor, error) {
+func makeUserAgent(ctx *generator.LoadCtx, cfg *common.Config) (generator.Processor, error) {
 	config := defaultConfig()
 	if err := cfg.Unpack(&config); err != nil {
 		return nil, err
@@ -34,6 +38,16 @@ func makeUserAgent(cfg *common.Config) (generator.Processor, error) {
 
 func (u *useragent) Name() string { return "useragent" }
 
+func (u *useragent) SourceField() string { return u.Field }
+
+func (u *useragent) Flow() (generator.Flow, error) {
+	to := u.To
+	if to == "" {
+		to = "user_agent"
+	}
+	return generator.Flow{Reads: []string{u.Field}, Writes: []string{to}}, nil
+}
+
 func (u *useragent) CompileIngest() ([]ingest.Processor, error) {
 	params := map[string]interface{}{
 		"field": u.Field,
@@ -41,29 +55,18 @@ func (u *useragent) CompileIngest() ([]ingest.Processor, error) {
 	if u.To != "" {
 		params["target_field"] = u.To
 	}
-	if u.IgnoreFailure {
-		params["ignore_failure"] = true
-	}
 
-	ps := ingest.MakeSingleProcessor("user_agent", params)
-	if u.DropField {
-		ps = append(ps, ingest.RemoveField(u.Field))
-	}
-	return ps, nil
+	return ingest.MakeSingleProcessor("user_agent", params), nil
 }
 
 // failure tag: none, need to generate custom tag handling
 func (u *useragent) CompileLogstash(ctx *generator.LogstashCtx) (generator.FilterBlock, error) {
-	var failureTag string
-	if !u.IgnoreFailure {
-		failureTag = ctx.CreateTag("_failure_useragent")
-	}
+	failureTag := ctx.CreateTag("_failure")
 
 	params := ls.Params{
 		"source": ls.NormalizeField(u.Field),
 	}
 	params.Target(u.To)
-	params.DropField(u.DropField, u.Field)
 	params.RemoveTag(failureTag)
 
 	blk := ls.MakeBlock(ls.MakeFilter("useragent", params))
@@ -76,6 +79,52 @@ func (u *useragent) CompileLogstash(ctx *generator.LogstashCtx) (generator.Filte
 	}, nil
 }
 
+func (u *useragent) CompileLocal() ([]local.Processor, error) {
+	to := u.To
+	if to == "" {
+		to = "user_agent"
+	}
+
+	parse := func(doc local.Document) error {
+		agent, _, err := doc.StringField(u.Field, false)
+		if err != nil {
+			return err
+		}
+		return doc.Put(to, uaparser.Parse(agent))
+	}
+
+	return local.Single(parse), nil
+}
+
 func defaultConfig() config {
 	return config{}
 }
+
+func importIngest(params map[string]interface{}) (map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"field":        "field",
+		"target_field": "target_field",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return generator.MakeImport("user_agent", config), nil
+}
+
+func importLogstash(params ls.Params) ([]map[string]interface{}, error) {
+	config, err := generator.ImportParams(params, map[string]string{
+		"source": "field",
+		"target": "target_field",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := config["target_field"]; !exists {
+		return nil, errors.New("useragent filters without target are not supported")
+	}
+	if err := generator.ImportFields(config, "field", "target_field"); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{generator.MakeImport("user_agent", config)}, nil
+}
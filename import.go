@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/elastic/beats/libbeat/common"
+
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/ingest"
+	"github.com/urso/bpb/prog/ls"
+)
+
+// importedPipeline is the YAML pipeline definition written by the import
+// commands.
+type importedPipeline struct {
+	Description string                   `yaml:"description,omitempty"`
+	Processors  []map[string]interface{} `yaml:"processors"`
+	OnFailure   []map[string]interface{} `yaml:"on_failure,omitempty"`
+}
+
+// ingestImport converts an Ingest Node pipeline definition into a pipeline
+// definition. Processors that can not be mapped are reported on stderr and
+// wrapped into a select processor with an ingest branch only.
+func ingestImport(inFile string, out io.Writer) error {
+	content, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return err
+	}
+
+	var pipeline ingest.Pipeline
+	if err := json.Unmarshal(content, &pipeline); err != nil {
+		return fmt.Errorf("failed to parse %v: %v", inFile, err)
+	}
+
+	var unmapped int
+	result := importedPipeline{Description: pipeline.Description}
+	result.Processors, unmapped = importIngestProcessors("processor", pipeline.Processors)
+
+	// the generator adds the default on_failure handler itself
+	if !isDefaultIngestOnFailure(pipeline.OnFailure) {
+		var n int
+		result.OnFailure, n = importIngestProcessors("on_failure processor", pipeline.OnFailure)
+		unmapped += n
+	}
+
+	if unmapped > 0 {
+		total := len(pipeline.Processors) + len(result.OnFailure)
+		fmt.Fprintf(os.Stderr, "%v of %v processors not mapped\n", unmapped, total)
+	}
+
+	return writeImport(out, result)
+}
+
+func importIngestProcessors(kind string, ps []ingest.Processor) ([]map[string]interface{}, int) {
+	var configs []map[string]interface{}
+	unmapped := 0
+	for i, p := range ps {
+		config, err := importIngestProcessor(p)
+		if err != nil {
+			unmapped++
+			fmt.Fprintf(os.Stderr, "%v %v (%v) not mapped, using ingest_processor: %v\n",
+				kind, i, ingestProcessorName(p), err)
+
+			config = map[string]interface{}{
+				"select": map[string]interface{}{
+					"ingest": []interface{}{
+						map[string]interface{}{"ingest_processor": p},
+					},
+				},
+			}
+		}
+		configs = append(configs, config)
+	}
+	return configs, unmapped
+}
+
+func importIngestProcessor(p ingest.Processor) (map[string]interface{}, error) {
+	if len(p) != 1 {
+		return nil, errors.New("processor definition must have exactly one entry")
+	}
+
+	name := ingestProcessorName(p)
+	importer := generator.FindIngestImport(name)
+	if importer == nil {
+		return nil, fmt.Errorf("no mapping for processor type '%v'", name)
+	}
+
+	// common options are supported by all processors
+	params := map[string]interface{}{}
+	options := map[string]interface{}{}
+	for k, v := range p[name] {
+		switch k {
+		case "tag", "description", "ignore_failure":
+			options[k] = v
+		case "on_failure":
+			handlers, err := importIngestHandlers(v)
+			if err != nil {
+				return nil, fmt.Errorf("on_failure: %v", err)
+			}
+			options[k] = handlers
+		default:
+			params[k] = v
+		}
+	}
+
+	config, err := importer(params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, settings := range config {
+		for k, v := range options {
+			settings.(map[string]interface{})[k] = v
+		}
+	}
+
+	// validate the mapped configuration loads
+	cfg, err := common.NewConfigFrom(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := generator.Load(&generator.LoadCtx{}, cfg); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// importIngestHandlers imports the on_failure processors of an ingest
+// processor. All handlers must be mapped.
+func importIngestHandlers(v interface{}) ([]interface{}, error) {
+	var ps []ingest.Processor
+	if raw, err := json.Marshal(v); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(raw, &ps); err != nil {
+		return nil, err
+	}
+
+	handlers := make([]interface{}, len(ps))
+	for i, p := range ps {
+		config, err := importIngestProcessor(p)
+		if err != nil {
+			return nil, err
+		}
+		handlers[i] = config
+	}
+	return handlers, nil
+}
+
+// isDefaultIngestOnFailure checks if the failure handlers match the handlers
+// added by the generator.
+func isDefaultIngestOnFailure(handlers []ingest.Processor) bool {
+	if len(handlers) == 0 {
+		return true
+	}
+
+	pipeline, err := (&generator.Generator{}).CompileIngest()
+	if err != nil {
+		return false
+	}
+
+	expected, _ := json.Marshal(pipeline.OnFailure)
+	actual, _ := json.Marshal(handlers)
+	return string(expected) == string(actual)
+}
+
+func ingestProcessorName(p ingest.Processor) string {
+	for name := range p {
+		return name
+	}
+	return ""
+}
+
+// mutateOrder lists the mutate operations in execution order.
+var mutateOrder = []string{
+	"coerce", "rename", "update", "replace", "convert", "gsub", "uppercase",
+	"capitalize", "lowercase", "strip", "remove", "split", "join", "merge", "copy",
+}
+
+// logstashImport converts the filter sections of a Logstash configuration into
+// a pipeline definition. Statements that can not be mapped are reported on
+// stderr and wrapped into a select processor with a logstash branch only.
+func logstashImport(inFile string, out io.Writer) error {
+	content, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return err
+	}
+
+	sections, err := ls.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse %v: %v", inFile, err)
+	}
+
+	var result importedPipeline
+	count, unmapped := 0, 0
+	for _, section := range sections {
+		if section.Type != "filter" {
+			fmt.Fprintf(os.Stderr, "%v section ignored\n", section.Type)
+			continue
+		}
+
+		for _, stmt := range section.Block {
+			configs, err := importLogstashStatement(stmt)
+			if err != nil {
+				unmapped++
+				fmt.Fprintf(os.Stderr, "statement %v (%v) not mapped, using logstash_filter: %v\n",
+					count, logstashStatementName(stmt), err)
+
+				configs, err = rawLogstashStatement(stmt)
+				if err != nil {
+					return err
+				}
+			}
+
+			result.Processors = append(result.Processors, configs...)
+			count++
+		}
+	}
+
+	if unmapped > 0 {
+		fmt.Fprintf(os.Stderr, "%v of %v statements not mapped\n", unmapped, count)
+	}
+
+	return writeImport(out, result)
+}
+
+func importLogstashStatement(stmt ls.Statement) ([]map[string]interface{}, error) {
+	filter, ok := stmt.(ls.Filter)
+	if !ok {
+		return nil, errors.New("conditionals are not supported")
+	}
+
+	params := ls.Params{}
+	for k, v := range filter.Params {
+		params[k] = v
+	}
+
+	// common filter options
+	id := params["id"]
+	for _, name := range []string{"id", "enable_metric", "periodic_flush"} {
+		delete(params, name)
+	}
+	for _, name := range []string{"add_field", "add_tag", "remove_tag"} {
+		if _, exists := params[name]; exists {
+			return nil, fmt.Errorf("option '%v' not supported", name)
+		}
+	}
+
+	var removeFields []interface{}
+	if v, exists := params["remove_field"]; exists {
+		delete(params, "remove_field")
+		switch v := v.(type) {
+		case []interface{}:
+			removeFields = v
+		default:
+			removeFields = []interface{}{v}
+		}
+	}
+
+	var configs []map[string]interface{}
+	var err error
+	if filter.Name == "mutate" {
+		configs, err = importMutate(params)
+	} else {
+		importer := generator.FindLogstashImport(filter.Name)
+		if importer == nil {
+			return nil, fmt.Errorf("no mapping for filter '%v'", filter.Name)
+		}
+		configs, err = importer(params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the filter id is kept as tag of the first processor
+	if id, ok := id.(string); ok && len(configs) > 0 {
+		for _, settings := range configs[0] {
+			settings.(map[string]interface{})["tag"] = id
+		}
+	}
+
+	// remove_field is applied only if the filter succeeds and ignores missing
+	// fields
+	for _, field := range removeFields {
+		ref, ok := field.(string)
+		if !ok {
+			return nil, errors.New("remove_field must be a list of field references")
+		}
+		configs = append(configs, generator.MakeImport("try_remove", map[string]interface{}{
+			"field": ls.FieldPath(ref),
+		}))
+	}
+
+	// validate the mapped configurations load
+	for _, config := range configs {
+		cfg, err := common.NewConfigFrom(config)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := generator.Load(&generator.LoadCtx{}, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return configs, nil
+}
+
+// importMutate splits a mutate filter into its operations. Each operation is
+// mapped by the importer registered as `mutate.<operation>`.
+func importMutate(params ls.Params) ([]map[string]interface{}, error) {
+	var configs []map[string]interface{}
+	for _, op := range mutateOrder {
+		v, exists := params[op]
+		if !exists {
+			continue
+		}
+
+		importer := generator.FindLogstashImport("mutate." + op)
+		if importer == nil {
+			return nil, fmt.Errorf("no mapping for mutate operation '%v'", op)
+		}
+
+		imported, err := importer(ls.Params{op: v})
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, imported...)
+		delete(params, op)
+	}
+
+	if len(params) > 0 {
+		var unknown []string
+		for k := range params {
+			unknown = append(unknown, k)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unsupported mutate settings %v", unknown)
+	}
+	return configs, nil
+}
+
+func rawLogstashStatement(stmt ls.Statement) ([]map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := ls.FormatBlock(&buf, ls.MakeBlock(stmt)); err != nil {
+		return nil, err
+	}
+
+	raw := generator.MakeImport("logstash_filter", map[string]interface{}{
+		"source": buf.String(),
+	})
+	return []map[string]interface{}{
+		generator.MakeImport("select", map[string]interface{}{
+			"logstash": []interface{}{raw},
+		}),
+	}, nil
+}
+
+func logstashStatementName(stmt ls.Statement) string {
+	if filter, ok := stmt.(ls.Filter); ok {
+		return filter.Name
+	}
+	return "conditional"
+}
+
+func writeImport(out io.Writer, p importedPipeline) error {
+	content, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(content)
+	return err
+}
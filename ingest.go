@@ -59,11 +59,23 @@ func cmdIngest() *cobra.Command {
 		},
 	}
 
+	cmdImport := &cobra.Command{
+		Use:   "import <pipeline.json>",
+		Short: "Import Ingest Node pipeline",
+		Long:  "Convert an Ingest Node pipeline definition into a pipeline configuration",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			if err := ingestImport(args[0], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
 	cmd := &cobra.Command{
 		Use:   "ingest",
 		Short: "Elasticsearch Ingest Node Mode",
 	}
-	cmd.AddCommand(cmdGenerate, cmdRun, cmdInstall)
+	cmd.AddCommand(cmdGenerate, cmdRun, cmdInstall, cmdImport)
 	cmd.PersistentFlags().StringVar(&host, "host", "http://localhost:9200", "Ingest node URL")
 	return cmd
 }
@@ -75,18 +87,74 @@ func ingestRun(
 	inFile string,
 	eventFormat string,
 ) error {
-	prog, err := gen.CompileIngest()
+	docs, err := readEvents(eventFormat, inFile)
 	if err != nil {
 		return err
 	}
 
-	docs, err := readEvents(eventFormat, inFile)
+	resp, err := ingestSimulate(gen, host, verbose, docs)
 	if err != nil {
 		return err
 	}
 
-	for i, doc := range docs {
-		docs[i] = map[string]interface{}{"_source": doc}
+	defer resp.Close()
+	_, err = io.Copy(os.Stdout, resp)
+	return err
+}
+
+// ingestProcess runs the events through the simulate API and returns the
+// resulting documents.
+func ingestProcess(
+	gen *generator.Generator,
+	host string,
+	events []map[string]interface{},
+) ([]map[string]interface{}, error) {
+	resp, err := ingestSimulate(gen, host, false, events)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	var result struct {
+		Error interface{} `json:"error"`
+		Docs  []struct {
+			Error interface{} `json:"error"`
+			Doc   *struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"doc"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(resp).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("simulate failed: %v", result.Error)
+	}
+
+	docs := make([]map[string]interface{}, len(result.Docs))
+	for i, doc := range result.Docs {
+		if doc.Doc == nil {
+			return nil, fmt.Errorf("event %v failed: %v", i, doc.Error)
+		}
+		docs[i] = doc.Doc.Source
+	}
+	return docs, nil
+}
+
+func ingestSimulate(
+	gen *generator.Generator,
+	host string,
+	verbose bool,
+	events []map[string]interface{},
+) (io.ReadCloser, error) {
+	prog, err := gen.CompileIngest()
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		docs[i] = map[string]interface{}{"_source": event}
 	}
 
 	simulate := struct {
@@ -97,7 +165,7 @@ func ingestRun(
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	if err := enc.Encode(simulate); err != nil {
-		return err
+		return nil, err
 	}
 
 	url := fmt.Sprintf("%v/_ingest/pipeline/_simulate?pretty", host)
@@ -107,12 +175,9 @@ func ingestRun(
 
 	resp, err := http.Post(url, "application/json", &buf)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	defer resp.Body.Close()
-	_, err = io.Copy(os.Stdout, resp.Body)
-	return err
+	return resp.Body, nil
 }
 
 func ingestInstall(
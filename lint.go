@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func cmdLint() *cobra.Command {
+	var fields []string
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the flow of fields through pipelines",
+		Long: `Check each pipeline file for processors reading or removing fields
+not written by any previous processor, and for fields being overwritten before
+they are read. Events are assumed to contain the input fields only.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			ok := true
+			for _, file := range args {
+				gen, err := loadPipeline([]string{file})
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				for _, issue := range gen.Lint(fields) {
+					fmt.Printf("%v: %v\n", file, issue)
+					ok = false
+				}
+			}
+
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringSliceVar(&fields, "fields", []string{"message", "@timestamp"}, "fields present in the input events")
+	return cmd
+}
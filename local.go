@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/urso/bpb/generator"
+	"github.com/urso/bpb/prog/local"
+)
+
+func cmdLocal() *cobra.Command {
+	var (
+		eventFormat string
+		inFile      string
+	)
+	cmdRun := &cobra.Command{
+		Use:   "run",
+		Short: "Run pipeline",
+		Long:  "Run pipeline in process with sample events. Resulting documents are printed as NDJSON",
+		Run: runWithPipeline(func(gen *generator.Generator) error {
+			return localRun(gen, inFile, eventFormat)
+		}),
+	}
+	cmdRun.PersistentFlags().StringVarP(&inFile, "in", "i", "", "event input file")
+	cmdRun.PersistentFlags().StringVar(&eventFormat, "format", "plain", "event format (one of plain or json)")
+
+	cmd := &cobra.Command{
+		Use:   "local",
+		Short: "Local Mode",
+	}
+	cmd.AddCommand(cmdRun)
+	return cmd
+}
+
+func localRun(
+	gen *generator.Generator,
+	inFile string,
+	eventFormat string,
+) error {
+	events, err := readEvents(eventFormat, inFile)
+	if err != nil {
+		return err
+	}
+
+	docs, err := localProcess(gen, events)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localProcess runs the events through the pipeline in process. The events
+// are modified in place.
+func localProcess(
+	gen *generator.Generator,
+	events []map[string]interface{},
+) ([]map[string]interface{}, error) {
+	pipeline, err := gen.CompileLocal()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		if err := pipeline.Run(local.Document(event)); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -53,6 +56,18 @@ func cmdLogstash() *cobra.Command {
 	cmdRun.PersistentFlags().StringVarP(&inFile, "in", "i", "", "event input file")
 	cmdRun.PersistentFlags().StringVar(&eventFormat, "format", "plain", "event format (one of plain or json)")
 
+	cmdImport := &cobra.Command{
+		Use:   "import <filter.conf>",
+		Short: "Import Logstash filter configuration",
+		Long:  "Convert the filter sections of a Logstash configuration into a pipeline configuration",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			if err := logstashImport(args[0], os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
 	cmd := &cobra.Command{
 		Use:   "logstash",
 		Short: "Logstash Mode",
@@ -60,7 +75,7 @@ func cmdLogstash() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&pipelineID, "id", "", "pipeline ID")
 	cmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose mode - create debug prints on each filter")
 	cmd.PersistentFlags().BoolVar(&noError, "noerr", false, "disable filter error handling")
-	cmd.AddCommand(cmdGenerate, cmdRun)
+	cmd.AddCommand(cmdGenerate, cmdRun, cmdImport)
 	return cmd
 }
 
@@ -70,14 +85,57 @@ func lsRun(
 	ctx *generator.LogstashCtx,
 	inFile, eventFormat string,
 ) error {
-	var err error
-	var lsBin string
-
-	eventReader, err := findEventReader(eventFormat)
+	events, err := readEvents(eventFormat, inFile)
 	if err != nil {
 		return err
 	}
 
+	return lsExec(lsHome, gen, ctx, events, `rubydebug { metadata => true }`, os.Stdout)
+}
+
+// lsProcess runs the events through logstash and returns the resulting
+// documents.
+func lsProcess(
+	lsHome string,
+	gen *generator.Generator,
+	ctx *generator.LogstashCtx,
+	events []map[string]interface{},
+) ([]map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := lsExec(lsHome, gen, ctx, events, "json_lines", &buf); err != nil {
+		return nil, err
+	}
+
+	// logstash logs are written to stdout as well -> only parse JSON documents
+	var docs []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(line, &doc); err != nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, scanner.Err()
+}
+
+func lsExec(
+	lsHome string,
+	gen *generator.Generator,
+	ctx *generator.LogstashCtx,
+	events []map[string]interface{},
+	codec string,
+	out io.Writer,
+) error {
+	var err error
+	var lsBin string
+
 	if lsHome == "" {
 		lsBin, err = exec.LookPath("logstash")
 		if err != nil {
@@ -87,12 +145,6 @@ func lsRun(
 		lsBin = filepath.Join(lsHome, "bin", "logstash")
 	}
 
-	eventsFile, err := os.Open(inFile)
-	if err != nil {
-		return err
-	}
-	defer eventsFile.Close()
-
 	confFile, err := ioutil.TempFile("", "lstestconf")
 	if err != nil {
 		return err
@@ -108,15 +160,15 @@ func lsRun(
 	if err := gen.MakeLogstash(confFile, ctx); err != nil {
 		return err
 	}
-	if _, err := io.WriteString(confFile, `output { stdout { codec => rubydebug { metadata => true } } }`); err != nil {
+	if _, err := fmt.Fprintf(confFile, `output { stdout { codec => %v } }`, codec); err != nil {
 		return err
 	}
 	if err := confFile.Sync(); err != nil {
 		return err
 	}
 
-	// start logstash:
-	cmd := exec.Command(lsBin, "-f", confFileName)
+	// start logstash (single worker to keep the event order):
+	cmd := exec.Command(lsBin, "-w", "1", "-f", confFileName)
 	eventRead, eventWrite, err := os.Pipe()
 	if err != nil {
 		return err
@@ -125,7 +177,7 @@ func lsRun(
 
 	// setup ls IO
 	cmd.Stdin = eventRead
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
 
 	// start event writer:
@@ -133,11 +185,11 @@ func lsRun(
 		defer eventWrite.Close()
 
 		enc := json.NewEncoder(eventWrite)
-		err := eventReader(eventsFile, func(event map[string]interface{}) error {
-			return enc.Encode(event)
-		})
-		if err != nil {
-			log.Printf("Copying event error: %v", err)
+		for _, event := range events {
+			if err := enc.Encode(event); err != nil {
+				log.Printf("Copying event error: %v", err)
+				return
+			}
 		}
 	}()
 
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -11,24 +14,32 @@ import (
 
 	// import available processor types
 	_ "github.com/urso/bpb/generator/convert"
+	_ "github.com/urso/bpb/generator/csv"
 	_ "github.com/urso/bpb/generator/date"
+	_ "github.com/urso/bpb/generator/dissect"
+	_ "github.com/urso/bpb/generator/fingerprint"
 	_ "github.com/urso/bpb/generator/geoip"
 	_ "github.com/urso/bpb/generator/grok"
 	_ "github.com/urso/bpb/generator/gsub"
 	_ "github.com/urso/bpb/generator/json"
 	_ "github.com/urso/bpb/generator/kv"
+	_ "github.com/urso/bpb/generator/normalize"
+	_ "github.com/urso/bpb/generator/raw"
 	_ "github.com/urso/bpb/generator/remove"
 	_ "github.com/urso/bpb/generator/rename"
 	_ "github.com/urso/bpb/generator/ruby"
 	_ "github.com/urso/bpb/generator/script"
 	_ "github.com/urso/bpb/generator/sel"
+	_ "github.com/urso/bpb/generator/set"
 	_ "github.com/urso/bpb/generator/split"
+	_ "github.com/urso/bpb/generator/try"
+	_ "github.com/urso/bpb/generator/uri"
 	_ "github.com/urso/bpb/generator/useragent"
 )
 
 func main() {
 	main := cobra.Command{Short: "beats pipeline builder"}
-	main.AddCommand(cmdLogstash(), cmdIngest())
+	main.AddCommand(cmdLogstash(), cmdIngest(), cmdLocal(), cmdTest(), cmdDiff(), cmdLint())
 	main.Execute()
 }
 
@@ -47,7 +58,17 @@ func runWithPipeline(
 	}
 }
 
+// loadPipeline builds the generator from the pipeline files. Errors are
+// reported with the file names.
 func loadPipeline(files []string) (*generator.Generator, error) {
+	gen, err := newGenerator(files)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", strings.Join(files, ", "), err)
+	}
+	return gen, nil
+}
+
+func newGenerator(files []string) (*generator.Generator, error) {
 	cfg, err := common.LoadFiles(files...)
 	if err != nil {
 		return nil, err
@@ -55,11 +76,18 @@ func loadPipeline(files []string) (*generator.Generator, error) {
 
 	pipeline := struct {
 		Description string           `config:"description"`
+		Patterns    []string         `config:"patterns"`
 		Processors  []*common.Config `config:"processors"`
+		OnFailure   []*common.Config `config:"on_failure"`
 	}{}
 	if err := cfg.Unpack(&pipeline); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return generator.New(pipeline.Description, pipeline.Processors)
+	// relative file names are resolved against the first pipeline file
+	settings := generator.Settings{Patterns: pipeline.Patterns}
+	if len(files) > 0 {
+		settings.Dir = filepath.Dir(files[0])
+	}
+	return generator.New(settings, pipeline.Description, pipeline.Processors, pipeline.OnFailure)
 }
@@ -0,0 +1,537 @@
+// Package cond implements a small condition language, that can be compiled to
+// Ingest Node painless conditions, Logstash conditionals and local matchers.
+//
+// Conditions support field existence checks, (in)equality, regular expression
+// matches, membership tests and boolean operators:
+//
+//	has(apache2.access.remote_ip)
+//	auditd.log.record_type == "SYSCALL"
+//	nginx.access.remote_ip !~ /^(10|127)\./
+//	auditd.log.record_type in ["USER_LOGIN", "USER_AUTH"]
+//	"_failure" in tags
+//	not has(error) and (a.b == 1 or a.c != "x")
+//
+// Fields are addressed by dotted paths. Missing fields and fields with null
+// values are treated the same. Logstash also treats fields with value false as
+// missing.
+//
+// Regular expressions are passed as is to the backends. Painless regular
+// expressions must be enabled in Elasticsearch via
+// `script.painless.regex.enabled`.
+package cond
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+)
+
+// Cond is a parsed condition.
+type Cond struct {
+	src  string
+	root node
+}
+
+// Matcher evaluates a condition on a document.
+type Matcher func(doc local.Document) bool
+
+type node interface {
+	painless() (string, error)
+	logstash() (string, error)
+	local() (Matcher, error)
+}
+
+type value interface {
+	painless() (string, error)
+	logstash() (string, error)
+	get(doc local.Document) (interface{}, bool)
+}
+
+type (
+	andNode struct{ left, right node }
+	orNode  struct{ left, right node }
+	notNode struct{ expr node }
+
+	hasNode struct{ field field }
+
+	compareNode struct {
+		negate      bool
+		left, right value
+	}
+
+	matchNode struct {
+		negate  bool
+		left    value
+		pattern string
+	}
+
+	inNode struct {
+		negate      bool
+		left, right value
+	}
+)
+
+type (
+	field   string
+	literal struct{ v interface{} }
+	list    []literal
+)
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Has creates a condition checking the field is present.
+func Has(name string) *Cond {
+	return &Cond{src: "has(" + name + ")", root: hasNode{field(name)}}
+}
+
+// NotEmpty creates a condition checking the field is present and not the
+// empty string.
+func NotEmpty(name string) *Cond {
+	return &Cond{
+		src: fmt.Sprintf(`has(%v) and %v != ""`, name, name),
+		root: andNode{
+			hasNode{field(name)},
+			compareNode{negate: true, left: field(name), right: literal{""}},
+		},
+	}
+}
+
+// Not creates a condition matching if c does not match.
+func Not(c *Cond) *Cond {
+	return &Cond{src: "not (" + c.src + ")", root: notNode{c.root}}
+}
+
+// And creates a condition matching if all conditions match. Returns nil if no
+// condition is given.
+func And(cs ...*Cond) *Cond {
+	return combine(cs, "and", func(l, r node) node { return andNode{l, r} })
+}
+
+// Or creates a condition matching if any of the conditions matches. Returns
+// nil if no condition is given.
+func Or(cs ...*Cond) *Cond {
+	return combine(cs, "or", func(l, r node) node { return orNode{l, r} })
+}
+
+func combine(cs []*Cond, op string, fn func(l, r node) node) *Cond {
+	if len(cs) == 0 {
+		return nil
+	}
+
+	c := cs[0]
+	for _, other := range cs[1:] {
+		c = &Cond{
+			src:  fmt.Sprintf("(%v) %v (%v)", c.src, op, other.src),
+			root: fn(c.root, other.root),
+		}
+	}
+	return c
+}
+
+func (c *Cond) String() string { return c.src }
+
+// Fields returns the names of all fields referenced by the condition.
+func (c *Cond) Fields() []string {
+	var fields []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch n := v.(type) {
+		case andNode:
+			walk(n.left)
+			walk(n.right)
+		case orNode:
+			walk(n.left)
+			walk(n.right)
+		case notNode:
+			walk(n.expr)
+		case hasNode:
+			walk(n.field)
+		case compareNode:
+			walk(n.left)
+			walk(n.right)
+		case matchNode:
+			walk(n.left)
+		case inNode:
+			walk(n.left)
+			walk(n.right)
+		case field:
+			fields = append(fields, string(n))
+		}
+	}
+	walk(c.root)
+	return fields
+}
+
+// CompileIngest creates the painless condition for the Ingest Node processor
+// `if` setting.
+func (c *Cond) CompileIngest() (string, error) {
+	s, err := c.root.painless()
+	if err != nil {
+		return "", fmt.Errorf("condition '%v': %v", c.src, err)
+	}
+	return s, nil
+}
+
+// CompileLogstash creates the Logstash conditional expression.
+func (c *Cond) CompileLogstash() (ls.Expression, error) {
+	s, err := c.root.logstash()
+	if err != nil {
+		return "", fmt.Errorf("condition '%v': %v", c.src, err)
+	}
+	return ls.Expression(s), nil
+}
+
+// CompileLocal creates a matcher for use with local processors.
+func (c *Cond) CompileLocal() (Matcher, error) {
+	m, err := c.root.local()
+	if err != nil {
+		return nil, fmt.Errorf("condition '%v': %v", c.src, err)
+	}
+	return m, nil
+}
+
+// boolean operators
+
+func (n andNode) painless() (string, error) {
+	return binaryOp(n.left.painless, "&&", n.right.painless)
+}
+
+func (n andNode) logstash() (string, error) {
+	return binaryOp(n.left.logstash, "and", n.right.logstash)
+}
+
+func (n andNode) local() (Matcher, error) {
+	left, right, err := localPair(n.left, n.right)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc local.Document) bool { return left(doc) && right(doc) }, nil
+}
+
+func (n orNode) painless() (string, error) {
+	return binaryOp(n.left.painless, "||", n.right.painless)
+}
+
+func (n orNode) logstash() (string, error) {
+	return binaryOp(n.left.logstash, "or", n.right.logstash)
+}
+
+func (n orNode) local() (Matcher, error) {
+	left, right, err := localPair(n.left, n.right)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc local.Document) bool { return left(doc) || right(doc) }, nil
+}
+
+func (n notNode) painless() (string, error) {
+	s, err := n.expr.painless()
+	return "!(" + s + ")", err
+}
+
+func (n notNode) logstash() (string, error) {
+	s, err := n.expr.logstash()
+	return "!(" + s + ")", err
+}
+
+func (n notNode) local() (Matcher, error) {
+	m, err := n.expr.local()
+	if err != nil {
+		return nil, err
+	}
+	return func(doc local.Document) bool { return !m(doc) }, nil
+}
+
+func binaryOp(left func() (string, error), op string, right func() (string, error)) (string, error) {
+	l, err := left()
+	if err != nil {
+		return "", err
+	}
+	r, err := right()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%v %v %v)", l, op, r), nil
+}
+
+func localPair(left, right node) (Matcher, Matcher, error) {
+	l, err := left.local()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := right.local()
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+// field existence
+
+func (n hasNode) painless() (string, error) {
+	s, err := n.field.painless()
+	return s + " != null", err
+}
+
+func (n hasNode) logstash() (string, error) {
+	return n.field.logstash()
+}
+
+func (n hasNode) local() (Matcher, error) {
+	return func(doc local.Document) bool {
+		_, ok := n.field.get(doc)
+		return ok
+	}, nil
+}
+
+// equality
+
+func (n compareNode) op() string {
+	if n.negate {
+		return "!="
+	}
+	return "=="
+}
+
+func (n compareNode) painless() (string, error) {
+	return binaryOp(n.left.painless, n.op(), n.right.painless)
+}
+
+func (n compareNode) logstash() (string, error) {
+	return binaryOp(n.left.logstash, n.op(), n.right.logstash)
+}
+
+func (n compareNode) local() (Matcher, error) {
+	return func(doc local.Document) bool {
+		a, _ := n.left.get(doc)
+		b, _ := n.right.get(doc)
+		return equal(a, b) != n.negate
+	}, nil
+}
+
+// regular expressions
+
+func (n matchNode) painless() (string, error) {
+	v, err := n.left.painless()
+	if err != nil {
+		return "", err
+	}
+
+	// guard against null values, as the matcher fails on null
+	s := fmt.Sprintf("(%v != null && %v =~ /%v/)", v, strings.Replace(v, "?.", ".", -1), n.pattern)
+	if n.negate {
+		s = "!" + s
+	}
+	return s, nil
+}
+
+func (n matchNode) logstash() (string, error) {
+	v, err := n.left.logstash()
+	if err != nil {
+		return "", err
+	}
+
+	op := "=~"
+	if n.negate {
+		op = "!~"
+	}
+	return fmt.Sprintf("%v %v /%v/", v, op, n.pattern), nil
+}
+
+func (n matchNode) local() (Matcher, error) {
+	re, err := regexp.Compile(strings.Replace(n.pattern, `\/`, "/", -1))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(doc local.Document) bool {
+		v, ok := n.left.get(doc)
+		s, isString := v.(string)
+		return (ok && isString && re.MatchString(s)) != n.negate
+	}, nil
+}
+
+// membership
+
+func (n inNode) painless() (string, error) {
+	l, err := n.left.painless()
+	if err != nil {
+		return "", err
+	}
+	r, err := n.right.painless()
+	if err != nil {
+		return "", err
+	}
+
+	var s string
+	if _, isField := n.right.(field); isField {
+		// works on lists and strings
+		s = fmt.Sprintf("%v?.contains(%v) == true", r, l)
+	} else {
+		s = fmt.Sprintf("%v.contains(%v)", r, l)
+	}
+
+	if n.negate {
+		s = "!(" + s + ")"
+	}
+	return s, nil
+}
+
+func (n inNode) logstash() (string, error) {
+	op := "in"
+	if n.negate {
+		op = "not in"
+	}
+	return binaryOp(n.left.logstash, op, n.right.logstash)
+}
+
+func (n inNode) local() (Matcher, error) {
+	return func(doc local.Document) bool {
+		return contains(doc, n.left, n.right) != n.negate
+	}, nil
+}
+
+func contains(doc local.Document, elem, container value) bool {
+	v, ok := elem.get(doc)
+	if !ok {
+		return false
+	}
+
+	c, ok := container.get(doc)
+	if !ok {
+		return false
+	}
+
+	switch c := c.(type) {
+	case []interface{}:
+		for _, x := range c {
+			if equal(v, x) {
+				return true
+			}
+		}
+	case string:
+		s, isString := v.(string)
+		return isString && strings.Contains(c, s)
+	}
+	return false
+}
+
+// values
+
+func (f field) painless() (string, error) {
+	var b strings.Builder
+	b.WriteString("ctx")
+	for i, name := range strings.Split(string(f), ".") {
+		switch {
+		case identifier.MatchString(name) && i == 0:
+			b.WriteString("." + name)
+		case identifier.MatchString(name):
+			b.WriteString("?." + name)
+		case i == 0:
+			b.WriteString("['" + name + "']")
+		default:
+			return "", fmt.Errorf("nested field name '%v' not supported in painless conditions", name)
+		}
+	}
+	return b.String(), nil
+}
+
+func (f field) logstash() (string, error) {
+	return ls.NormalizeField(string(f)), nil
+}
+
+func (f field) get(doc local.Document) (interface{}, bool) {
+	v, ok := doc.Get(string(f))
+	return v, ok && v != nil
+}
+
+func (l literal) painless() (string, error) {
+	if s, ok := l.v.(string); ok {
+		s = strings.Replace(s, `\`, `\\`, -1)
+		s = strings.Replace(s, `'`, `\'`, -1)
+		return "'" + s + "'", nil
+	}
+	return fmt.Sprint(l.v), nil
+}
+
+func (l literal) logstash() (string, error) {
+	switch v := l.v.(type) {
+	case string:
+		// Logstash strings have no escape sequences
+		switch {
+		case !strings.Contains(v, `"`):
+			return `"` + v + `"`, nil
+		case !strings.Contains(v, `'`):
+			return `'` + v + `'`, nil
+		default:
+			return "", fmt.Errorf("string %q with single and double quotes not supported in Logstash conditions", v)
+		}
+	case bool:
+		return "", fmt.Errorf("boolean literal '%v' not supported in Logstash conditions", v)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+func (l literal) get(doc local.Document) (interface{}, bool) {
+	return l.v, true
+}
+
+func (l list) painless() (string, error) {
+	return l.join(literal.painless)
+}
+
+func (l list) logstash() (string, error) {
+	return l.join(literal.logstash)
+}
+
+func (l list) join(fn func(literal) (string, error)) (string, error) {
+	elems := make([]string, len(l))
+	for i, elem := range l {
+		s, err := fn(elem)
+		if err != nil {
+			return "", err
+		}
+		elems[i] = s
+	}
+	return "[" + strings.Join(elems, ", ") + "]", nil
+}
+
+func (l list) get(doc local.Document) (interface{}, bool) {
+	values := make([]interface{}, len(l))
+	for i, elem := range l {
+		values[i] = elem.v
+	}
+	return values, true
+}
+
+// equal compares two values. Numbers are compared by value, independent of
+// their type.
+func equal(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b) && fmt.Sprintf("%T", a) == fmt.Sprintf("%T", b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case interface{ Float64() (float64, error) }:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,352 @@
+package cond
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenType uint8
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokRegex
+	tokOp
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	pos  int
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a condition.
+func Parse(s string) (*Cond, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, fmt.Errorf("condition '%v': %v", s, err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().typ != tokEOF {
+		err = p.errorf("unexpected '%v'", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("condition '%v': %v", s, err)
+	}
+
+	return &Cond{src: s, root: root}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("offset %v: %v", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.typ == tokIdent && t.text == kw
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.typ == tokOp && t.text == op
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected '%v'", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	switch {
+	case p.isOp("("):
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectOp(")")
+
+	case p.isKeyword("has"):
+		p.next()
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		if t.typ != tokIdent {
+			return nil, p.errorf("expected field name")
+		}
+		return hasNode{field(t.text)}, p.expectOp(")")
+	}
+
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isOp("==") || p.isOp("!="):
+		negate := p.next().text == "!="
+		right, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{negate, left, right}, nil
+
+	case p.isOp("=~") || p.isOp("!~"):
+		negate := p.next().text == "!~"
+		t := p.next()
+		if t.typ != tokRegex {
+			return nil, p.errorf("expected regular expression")
+		}
+		return matchNode{negate, left, t.text}, nil
+
+	case p.isKeyword("in"):
+		p.next()
+		return p.parseIn(false, left)
+
+	case p.isKeyword("not"):
+		p.next()
+		if !p.isKeyword("in") {
+			return nil, p.errorf("expected 'in'")
+		}
+		p.next()
+		return p.parseIn(true, left)
+	}
+
+	return nil, p.errorf("expected operator")
+}
+
+func (p *parser) parseIn(negate bool, left value) (node, error) {
+	right, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch right.(type) {
+	case field, list:
+		return inNode{negate, left, right}, nil
+	default:
+		return nil, p.errorf("'in' requires a list or field")
+	}
+}
+
+func (p *parser) parseValue() (value, error) {
+	if p.isOp("[") {
+		return p.parseList()
+	}
+
+	t := p.peek()
+	if t.typ == tokIdent {
+		switch t.text {
+		case "and", "or", "not", "in", "has":
+			return nil, p.errorf("unexpected '%v'", t.text)
+		case "true", "false":
+			p.next()
+			return literal{t.text == "true"}, nil
+		}
+		p.next()
+		return field(t.text), nil
+	}
+
+	return p.parseLiteral()
+}
+
+func (p *parser) parseLiteral() (literal, error) {
+	t := p.peek()
+	switch t.typ {
+	case tokString:
+		p.next()
+		return literal{t.text}, nil
+	case tokNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return literal{i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return literal{}, p.errorf("invalid number '%v'", t.text)
+		}
+		return literal{f}, nil
+	case tokIdent:
+		if t.text == "true" || t.text == "false" {
+			p.next()
+			return literal{t.text == "true"}, nil
+		}
+	}
+	return literal{}, p.errorf("expected value")
+}
+
+func (p *parser) parseList() (list, error) {
+	p.next() // '['
+
+	l := list{}
+	for !p.isOp("]") {
+		if len(l) > 0 {
+			if err := p.expectOp(","); err != nil {
+				return nil, err
+			}
+		}
+
+		elem, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, elem)
+	}
+	p.next()
+	return l, nil
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	regexAllowed := false
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+
+		case c == '"' || c == '\'':
+			var buf strings.Builder
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("offset %v: unterminated string", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, buf.String(), start})
+
+		case c == '/' && regexAllowed:
+			for i++; i < len(s) && s[i] != '/'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("offset %v: unterminated regular expression", start)
+			}
+			i++
+			tokens = append(tokens, token{tokRegex, s[start+1 : i-1], start})
+
+		case c == '-' || isDigit(c):
+			for i++; i < len(s) && (isDigit(s[i]) || s[i] == '.'); i++ {
+			}
+			tokens = append(tokens, token{tokNumber, s[start:i], start})
+
+		case isFieldStart(c):
+			for i++; i < len(s) && isFieldChar(s[i]); i++ {
+			}
+			tokens = append(tokens, token{tokIdent, s[start:i], start})
+
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "=~", "!~", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("offset %v: unexpected character '%c'", start, c)
+			}
+			i += len(op)
+			tokens = append(tokens, token{tokOp, op, start})
+		}
+
+		last := tokens[len(tokens)-1]
+		regexAllowed = last.typ == tokOp && (last.text == "=~" || last.text == "!~")
+	}
+
+	return append(tokens, token{tokEOF, "end of condition", len(s)}), nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isFieldStart(c byte) bool {
+	return c == '_' || c == '@' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isFieldChar(c byte) bool {
+	return isFieldStart(c) || isDigit(c) || c == '.' || c == '-'
+}
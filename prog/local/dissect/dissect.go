@@ -0,0 +1,266 @@
+// Package dissect implements the dissect tokenizer used by the Ingest Node
+// dissect processor and the Logstash dissect filter.
+//
+// A pattern consists of keys like `%{name}` separated by delimiters. Keys
+// support the modifiers:
+//
+//	%{+name}    append the value to the field, optionally ordered by `/n`
+//	%{?name}    skip the value, like `%{}`
+//	%{*name}    use the value as field name for the `&name` key
+//	%{&name}    use the value as value of the field named by the `*name` key
+//	%{name->}   skip repeated delimiters following the value
+package dissect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Modifier configures how the value of a key is stored.
+type Modifier uint8
+
+const (
+	// None stores the value in the field named by the key.
+	None Modifier = iota
+
+	// Append appends the value to the field named by the key.
+	Append
+
+	// Skip discards the value.
+	Skip
+
+	// NamedRef uses the value as field name of the matching ValueRef key.
+	NamedRef
+
+	// ValueRef stores the value in the field named by the matching NamedRef
+	// key.
+	ValueRef
+)
+
+// Key is a key of a dissect pattern.
+type Key struct {
+	Name     string
+	Modifier Modifier
+
+	// Order of appended values, configured via `/n`
+	Order int
+
+	// Padding is set if repeated delimiters following the value are skipped.
+	Padding bool
+}
+
+// Dissector splits strings into fields.
+type Dissector struct {
+	prefix string
+	keys   []Key
+
+	// delims[i] is the delimiter following keys[i]
+	delims []string
+}
+
+// ErrNoMatch is returned by Dissect if the input does not match the pattern.
+var ErrNoMatch = errors.New("unable to find match for dissect pattern")
+
+var keyPattern = regexp.MustCompile(`%\{([^}]*)\}`)
+
+var modifiers = map[byte]Modifier{
+	'+': Append,
+	'?': Skip,
+	'*': NamedRef,
+	'&': ValueRef,
+}
+
+var modifierChars = map[Modifier]string{
+	Append:   "+",
+	Skip:     "?",
+	NamedRef: "*",
+	ValueRef: "&",
+}
+
+// Parse parses a dissect pattern.
+func Parse(pattern string) (*Dissector, error) {
+	matches := keyPattern.FindAllStringSubmatchIndex(pattern, -1)
+	if len(matches) == 0 {
+		return nil, errors.New("pattern has no keys")
+	}
+
+	d := &Dissector{prefix: pattern[:matches[0][0]]}
+	for i, m := range matches {
+		key, err := parseKey(pattern[m[2]:m[3]])
+		if err != nil {
+			return nil, err
+		}
+
+		end := len(pattern)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		delim := pattern[m[1]:end]
+		if delim == "" && i+1 < len(matches) {
+			return nil, fmt.Errorf("missing delimiter between keys at offset %v", m[1])
+		}
+
+		d.keys = append(d.keys, key)
+		d.delims = append(d.delims, delim)
+	}
+
+	refs := map[string]int{}
+	for _, key := range d.keys {
+		switch key.Modifier {
+		case NamedRef:
+			refs[key.Name]++
+		case ValueRef:
+			refs[key.Name]--
+		}
+	}
+	for name, n := range refs {
+		if n != 0 {
+			return nil, fmt.Errorf("reference key '%v' requires one '*%v' and one '&%v' key", name, name, name)
+		}
+	}
+
+	return d, nil
+}
+
+func parseKey(s string) (Key, error) {
+	var key Key
+	if strings.HasSuffix(s, "->") {
+		key.Padding = true
+		s = s[:len(s)-2]
+	}
+	if s == "" {
+		key.Modifier = Skip
+		return key, nil
+	}
+
+	if m, ok := modifiers[s[0]]; ok {
+		key.Modifier = m
+		s = s[1:]
+	}
+	if idx := strings.LastIndexByte(s, '/'); idx >= 0 && key.Modifier == Append {
+		order, err := strconv.Atoi(s[idx+1:])
+		if err != nil {
+			return key, fmt.Errorf("invalid append order in key '%v'", s)
+		}
+		key.Order = order
+		s = s[:idx]
+	}
+	if s == "" && key.Modifier != Skip {
+		return key, errors.New("key name missing")
+	}
+
+	key.Name = s
+	return key, nil
+}
+
+// Keys returns the keys of the pattern.
+func (d *Dissector) Keys() []Key {
+	return d.keys
+}
+
+// Format creates the pattern from the keys. The key names are replaced with
+// the result of fn.
+func (d *Dissector) Format(fn func(Key) Key) string {
+	var b strings.Builder
+	b.WriteString(d.prefix)
+	for i, key := range d.keys {
+		key = fn(key)
+
+		b.WriteString("%{")
+		if key.Modifier != Skip || key.Name != "" {
+			b.WriteString(modifierChars[key.Modifier])
+		}
+		b.WriteString(key.Name)
+		if key.Order > 0 {
+			fmt.Fprintf(&b, "/%v", key.Order)
+		}
+		if key.Padding {
+			b.WriteString("->")
+		}
+		b.WriteString("}")
+		b.WriteString(d.delims[i])
+	}
+	return b.String()
+}
+
+// AppendGroups returns the indices of the keys appending to the same field,
+// in order of the appended values. Keys without append modifier are part of
+// the group if other keys append to the same field.
+func (d *Dissector) AppendGroups() map[string][]int {
+	groups := map[string][]int{}
+	for _, key := range d.keys {
+		if key.Modifier == Append {
+			groups[key.Name] = nil
+		}
+	}
+	for i, key := range d.keys {
+		if _, exists := groups[key.Name]; exists && (key.Modifier == Append || key.Modifier == None) {
+			groups[key.Name] = append(groups[key.Name], i)
+		}
+	}
+	for _, indices := range groups {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return d.keys[indices[a]].Order < d.keys[indices[b]].Order
+		})
+	}
+	return groups
+}
+
+// Dissect splits the input into fields. Appended values are joined using the
+// separator.
+func (d *Dissector) Dissect(in, separator string) (map[string]string, error) {
+	if !strings.HasPrefix(in, d.prefix) {
+		return nil, ErrNoMatch
+	}
+
+	values := make([]string, len(d.keys))
+	pos := len(d.prefix)
+	for i, key := range d.keys {
+		delim := d.delims[i]
+		if delim == "" {
+			values[i] = in[pos:]
+			pos = len(in)
+			continue
+		}
+
+		idx := strings.Index(in[pos:], delim)
+		if idx < 0 {
+			return nil, ErrNoMatch
+		}
+		values[i] = in[pos : pos+idx]
+		pos += idx + len(delim)
+		if key.Padding {
+			for strings.HasPrefix(in[pos:], delim) {
+				pos += len(delim)
+			}
+		}
+	}
+
+	fields := map[string]string{}
+	names := map[string]string{}
+	for i, key := range d.keys {
+		switch key.Modifier {
+		case None:
+			fields[key.Name] = values[i]
+		case NamedRef:
+			names[key.Name] = values[i]
+		}
+	}
+	for i, key := range d.keys {
+		if key.Modifier == ValueRef {
+			fields[names[key.Name]] = values[i]
+		}
+	}
+	for name, indices := range d.AppendGroups() {
+		parts := make([]string, len(indices))
+		for i, idx := range indices {
+			parts[i] = values[idx]
+		}
+		fields[name] = strings.Join(parts, separator)
+	}
+	return fields, nil
+}
@@ -0,0 +1,369 @@
+package grok
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// backtracker matches patterns using constructs not supported by go regexp,
+// like lookaround assertions and atomic groups. The translator rewrites these
+// constructs into named groups, which are interpreted by the backtracker.
+type backtracker struct {
+	re    *syntax.Regexp
+	names []string
+}
+
+// machine holds the state of a single match attempt.
+type machine struct {
+	in   string
+	caps []int
+}
+
+// special group names generated by the translator
+const (
+	groupLookahead     = "la"
+	groupNegLookahead  = "nla"
+	groupLookbehind    = "lb"
+	groupNegLookbehind = "nlb"
+	groupAtomic        = "atomic"
+)
+
+func compileBacktrack(src string) (*backtracker, error) {
+	re, err := syntax.Parse(src, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLookbehind(re); err != nil {
+		return nil, err
+	}
+	return &backtracker{re: re, names: re.CapNames()}, nil
+}
+
+// checkLookbehind validates the length of all lookbehind assertions is
+// bounded.
+func checkLookbehind(re *syntax.Regexp) error {
+	if re.Op == syntax.OpCapture {
+		switch groupKind(re.Name) {
+		case groupLookbehind, groupNegLookbehind:
+			if _, max := width(re.Sub[0]); max < 0 {
+				return fmt.Errorf("lookbehind of unbounded length not supported: %v", re.Sub[0])
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if err := checkLookbehind(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupKind returns the kind of a special group, or an empty string for
+// regular capture groups.
+func groupKind(name string) string {
+	kind := strings.TrimRight(name, "0123456789")
+	switch kind {
+	case groupLookahead, groupNegLookahead, groupLookbehind, groupNegLookbehind, groupAtomic:
+		if kind != name {
+			return kind
+		}
+	}
+	return ""
+}
+
+// FindStringSubmatchIndex returns the leftmost match, using the same index
+// layout as regexp.Regexp.FindStringSubmatchIndex.
+func (b *backtracker) FindStringSubmatchIndex(in string) []int {
+	for start := 0; ; {
+		m := &machine{in: in, caps: make([]int, 2*len(b.names))}
+		for i := range m.caps {
+			m.caps[i] = -1
+		}
+
+		matched := m.match(b.re, start, func(end int) bool {
+			m.caps[0], m.caps[1] = start, end
+			return true
+		})
+		if matched {
+			return m.caps
+		}
+
+		if start >= len(in) {
+			return nil
+		}
+		_, w := utf8.DecodeRuneInString(in[start:])
+		start += w
+	}
+}
+
+// match tries to match re at pos. On success k is called with the end of the
+// match. Alternatives are tried in order until k returns true.
+func (m *machine) match(re *syntax.Regexp, pos int, k func(int) bool) bool {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return false
+
+	case syntax.OpEmptyMatch:
+		return k(pos)
+
+	case syntax.OpLiteral:
+		for _, want := range re.Rune {
+			r, w := utf8.DecodeRuneInString(m.in[pos:])
+			if w == 0 || !(r == want || re.Flags&syntax.FoldCase != 0 && equalFold(r, want)) {
+				return false
+			}
+			pos += w
+		}
+		return k(pos)
+
+	case syntax.OpCharClass:
+		r, w := utf8.DecodeRuneInString(m.in[pos:])
+		if w == 0 || !inClass(r, re.Rune) {
+			return false
+		}
+		return k(pos + w)
+
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		r, w := utf8.DecodeRuneInString(m.in[pos:])
+		if w == 0 || re.Op == syntax.OpAnyCharNotNL && r == '\n' {
+			return false
+		}
+		return k(pos + w)
+
+	case syntax.OpBeginLine:
+		return (pos == 0 || m.in[pos-1] == '\n') && k(pos)
+	case syntax.OpEndLine:
+		return (pos == len(m.in) || m.in[pos] == '\n') && k(pos)
+	case syntax.OpBeginText:
+		return pos == 0 && k(pos)
+	case syntax.OpEndText:
+		return pos == len(m.in) && k(pos)
+	case syntax.OpWordBoundary:
+		return m.wordBoundary(pos) && k(pos)
+	case syntax.OpNoWordBoundary:
+		return !m.wordBoundary(pos) && k(pos)
+
+	case syntax.OpCapture:
+		return m.group(re, pos, k)
+
+	case syntax.OpStar:
+		return m.repeat(re.Sub[0], 0, -1, re.Flags&syntax.NonGreedy == 0, pos, k)
+	case syntax.OpPlus:
+		return m.repeat(re.Sub[0], 1, -1, re.Flags&syntax.NonGreedy == 0, pos, k)
+	case syntax.OpQuest:
+		return m.repeat(re.Sub[0], 0, 1, re.Flags&syntax.NonGreedy == 0, pos, k)
+	case syntax.OpRepeat:
+		return m.repeat(re.Sub[0], re.Min, re.Max, re.Flags&syntax.NonGreedy == 0, pos, k)
+
+	case syntax.OpConcat:
+		return m.concat(re.Sub, pos, k)
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if m.match(sub, pos, k) {
+				return true
+			}
+		}
+		return false
+
+	default:
+		return false
+	}
+}
+
+func (m *machine) group(re *syntax.Regexp, pos int, k func(int) bool) bool {
+	sub := re.Sub[0]
+	found := func(int) bool { return true }
+
+	switch groupKind(re.Name) {
+	case groupLookahead:
+		saved := m.save()
+		if m.match(sub, pos, found) && k(pos) {
+			return true
+		}
+		m.restore(saved)
+		return false
+
+	case groupNegLookahead:
+		saved := m.save()
+		matched := m.match(sub, pos, found)
+		m.restore(saved)
+		return !matched && k(pos)
+
+	case groupLookbehind:
+		saved := m.save()
+		if m.lookbehind(sub, pos) && k(pos) {
+			return true
+		}
+		m.restore(saved)
+		return false
+
+	case groupNegLookbehind:
+		saved := m.save()
+		matched := m.lookbehind(sub, pos)
+		m.restore(saved)
+		return !matched && k(pos)
+
+	case groupAtomic:
+		// commit to the first match of the group
+		saved := m.save()
+		end := -1
+		if m.match(sub, pos, func(e int) bool { end = e; return true }) && k(end) {
+			return true
+		}
+		m.restore(saved)
+		return false
+	}
+
+	return m.match(sub, pos, func(end int) bool {
+		i := 2 * re.Cap
+		start0, end0 := m.caps[i], m.caps[i+1]
+		m.caps[i], m.caps[i+1] = pos, end
+		if k(end) {
+			return true
+		}
+		m.caps[i], m.caps[i+1] = start0, end0
+		return false
+	})
+}
+
+// lookbehind checks if re matches a substring ending at pos.
+func (m *machine) lookbehind(re *syntax.Regexp, pos int) bool {
+	min, max := width(re)
+	start := pos
+	for n := 0; n <= max; n++ {
+		if n >= min && m.match(re, start, func(end int) bool { return end == pos }) {
+			return true
+		}
+		if start == 0 {
+			return false
+		}
+		_, w := utf8.DecodeLastRuneInString(m.in[:start])
+		start -= w
+	}
+	return false
+}
+
+func (m *machine) repeat(re *syntax.Regexp, min, max int, greedy bool, pos int, k func(int) bool) bool {
+	var iter func(n, pos int) bool
+	iter = func(n, pos int) bool {
+		if n < min {
+			return m.match(re, pos, func(end int) bool { return iter(n+1, end) })
+		}
+
+		more := func() bool {
+			if max >= 0 && n >= max {
+				return false
+			}
+			// stop on empty iterations, such that matching terminates
+			return m.match(re, pos, func(end int) bool { return end != pos && iter(n+1, end) })
+		}
+		if greedy {
+			return more() || k(pos)
+		}
+		return k(pos) || more()
+	}
+	return iter(0, pos)
+}
+
+func (m *machine) concat(seq []*syntax.Regexp, pos int, k func(int) bool) bool {
+	if len(seq) == 0 {
+		return k(pos)
+	}
+	return m.match(seq[0], pos, func(end int) bool { return m.concat(seq[1:], end, k) })
+}
+
+func (m *machine) wordBoundary(pos int) bool {
+	before := pos > 0 && syntax.IsWordChar(rune(m.in[pos-1]))
+	after := pos < len(m.in) && syntax.IsWordChar(rune(m.in[pos]))
+	return before != after
+}
+
+func (m *machine) save() []int {
+	return append([]int(nil), m.caps...)
+}
+
+func (m *machine) restore(saved []int) {
+	copy(m.caps, saved)
+}
+
+// width returns the minimum and maximum number of runes matched by re. The
+// maximum is -1 if unbounded.
+func width(re *syntax.Regexp) (min, max int) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune), len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		return 1, 1
+	case syntax.OpCapture:
+		switch groupKind(re.Name) {
+		case groupLookahead, groupNegLookahead, groupLookbehind, groupNegLookbehind:
+			return 0, 0
+		}
+		return width(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		lo, hi := 0, 1
+		switch re.Op {
+		case syntax.OpStar:
+			hi = -1
+		case syntax.OpPlus:
+			lo, hi = 1, -1
+		case syntax.OpRepeat:
+			lo, hi = re.Min, re.Max
+		}
+		subMin, subMax := width(re.Sub[0])
+		if subMax == 0 {
+			return 0, 0
+		}
+		if hi < 0 || subMax < 0 {
+			return lo * subMin, -1
+		}
+		return lo * subMin, hi * subMax
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			subMin, subMax := width(sub)
+			min += subMin
+			if max >= 0 {
+				max = subMax + max
+				if subMax < 0 {
+					max = -1
+				}
+			}
+		}
+		return min, max
+	case syntax.OpAlternate:
+		for i, sub := range re.Sub {
+			subMin, subMax := width(sub)
+			if i == 0 || subMin < min {
+				min = subMin
+			}
+			if max >= 0 && (subMax < 0 || subMax > max) {
+				max = subMax
+			}
+		}
+		return min, max
+	default:
+		return 0, 0
+	}
+}
+
+func inClass(r rune, class []rune) bool {
+	for i := 0; i+1 < len(class); i += 2 {
+		if class[i] <= r && r <= class[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+func equalFold(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,542 @@
+// Package grok implements grok pattern matching on top of the go regexp
+// package.
+//
+// Grok patterns are written for the Oniguruma/Joni regex engines used by
+// Logstash and Elasticsearch. Patterns using lookaround assertions, atomic
+// groups or possessive quantifiers are not supported by go regexp. These
+// patterns are matched by a backtracking matcher instead. Backreferences are
+// not supported.
+package grok
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Grok matches strings against a list of grok patterns.
+type Grok struct {
+	patterns []*pattern
+}
+
+// Capture describes a named capture in a grok pattern, like
+// `%{NUMBER:field:int}`.
+type Capture struct {
+	Field string
+	Type  string
+}
+
+type pattern struct {
+	re       matcher
+	captures map[int]Capture
+}
+
+// matcher is implemented by regexp.Regexp and backtracker.
+type matcher interface {
+	FindStringSubmatchIndex(s string) []int
+}
+
+// ErrNoMatch is returned by Match if no pattern matches the input.
+var ErrNoMatch = errors.New("no grok pattern matches")
+
+var refPattern = regexp.MustCompile(`%\{(\w+)(?::([\w@\[\]\.\-]+))?(?::(\w+))?\}`)
+
+var patternName = regexp.MustCompile(`^\w+$`)
+
+// Compile resolves the pattern references in all patterns and compiles them to
+// regular expressions. Custom definitions take precedence over the standard
+// pattern library.
+func Compile(patterns []string, definitions map[string]string) (*Grok, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no grok pattern configured")
+	}
+
+	g := &Grok{}
+	for i, p := range patterns {
+		compiled, err := compilePattern(p, definitions)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", i, err)
+		}
+		g.patterns = append(g.patterns, compiled)
+	}
+	return g, nil
+}
+
+// Match returns the fields captured by the first matching pattern.
+func (g *Grok) Match(in string) (map[string]interface{}, error) {
+	for _, p := range g.patterns {
+		idx := p.re.FindStringSubmatchIndex(in)
+		if idx == nil {
+			continue
+		}
+
+		fields := map[string]interface{}{}
+		for i := 1; i < len(idx)/2; i++ {
+			capture, ok := p.captures[i]
+			if !ok || idx[2*i] < 0 {
+				continue
+			}
+
+			value, err := convert(in[idx[2*i]:idx[2*i+1]], capture.Type)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert field '%v': %v", capture.Field, err)
+			}
+			fields[capture.Field] = value
+		}
+		return fields, nil
+	}
+
+	return nil, ErrNoMatch
+}
+
+// LoadPatterns reads a pattern file. Each line defines a pattern by name and
+// regular expression, separated by whitespace. Empty lines and lines starting
+// with `#` are ignored.
+func LoadPatterns(r io.Reader) (map[string]string, error) {
+	patterns := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.IndexAny(line, " \t")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %v: missing regular expression for pattern '%v'", lineNo, line)
+		}
+		name, def := line[:idx], strings.TrimLeft(line[idx:], " \t")
+		if !patternName.MatchString(name) {
+			return nil, fmt.Errorf("line %v: invalid pattern name '%v'", lineNo, name)
+		}
+		patterns[name] = def
+	}
+	return patterns, scanner.Err()
+}
+
+// LoadPatternFile reads the patterns from a pattern file.
+func LoadPatternFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns, err := LoadPatterns(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return patterns, nil
+}
+
+// Referenced returns the definitions referenced by the patterns, directly or
+// via other definitions and standard patterns.
+func Referenced(patterns []string, definitions map[string]string) map[string]string {
+	referenced := map[string]string{}
+	visited := map[string]bool{}
+
+	var visit func(p string)
+	visit = func(p string) {
+		for _, m := range refPattern.FindAllStringSubmatch(p, -1) {
+			name := m[1]
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			if def, exists := definitions[name]; exists {
+				referenced[name] = def
+				visit(def)
+			} else if def, exists := stdPatterns[name]; exists {
+				visit(def)
+			}
+		}
+	}
+	for _, p := range patterns {
+		visit(p)
+	}
+	return referenced
+}
+
+// MapCaptures replaces the field name and type of all named pattern
+// references in the pattern with the result of fn.
+func MapCaptures(p string, fn func(Capture) Capture) string {
+	return refPattern.ReplaceAllStringFunc(p, func(ref string) string {
+		m := refPattern.FindStringSubmatch(ref)
+		if m[2] == "" {
+			return ref
+		}
+
+		capture := fn(Capture{Field: m[2], Type: m[3]})
+		ref = "%{" + m[1] + ":" + capture.Field
+		if capture.Type != "" {
+			ref += ":" + capture.Type
+		}
+		return ref + "}"
+	})
+}
+
+// ParseCaptures returns the named captures of each pattern, in the order they
+// appear in the pattern. Patterns are not compiled, such that patterns not
+// supported by the go regexp package can be inspected. References to unknown
+// patterns are not expanded, only the capture of the reference is reported.
+func ParseCaptures(patterns []string, definitions map[string]string) ([][]Capture, error) {
+	all := make([][]Capture, len(patterns))
+	for i, p := range patterns {
+		expanded, err := expand(p, definitions, nil, true)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", i, err)
+		}
+
+		tr := newTranslator(expanded)
+		if _, err := tr.translate(); err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", i, err)
+		}
+		for id := 0; id < len(tr.captures); id++ {
+			all[i] = append(all[i], tr.captures[id])
+		}
+	}
+	return all, nil
+}
+
+func compilePattern(p string, definitions map[string]string) (*pattern, error) {
+	expanded, err := expand(p, definitions, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := newTranslator(expanded)
+	src, err := tr.translate()
+	if err != nil {
+		return nil, err
+	}
+	if tr.unsupported != nil {
+		return nil, tr.unsupported
+	}
+
+	var re matcher
+	var names []string
+	if tr.backtrack {
+		b, err := compileBacktrack(src)
+		if err != nil {
+			return nil, err
+		}
+		re, names = b, b.names
+	} else {
+		r, err := regexp.Compile(src)
+		if err != nil {
+			return nil, err
+		}
+		re, names = r, r.SubexpNames()
+	}
+
+	// map go group names to capture indices
+	captures := map[int]Capture{}
+	for i, name := range names {
+		if strings.HasPrefix(name, "grok") {
+			id, _ := strconv.Atoi(name[len("grok"):])
+			captures[i] = tr.captures[id]
+		}
+	}
+
+	return &pattern{re: re, captures: captures}, nil
+}
+
+// expand recursively replaces all pattern references with the referenced
+// regular expression. Named references are wrapped into a named group, using
+// the field name and type as group name. If lenient is set, references to
+// unknown patterns are replaced with an empty group.
+func expand(p string, definitions map[string]string, stack []string, lenient bool) (string, error) {
+	var err error
+	out := refPattern.ReplaceAllStringFunc(p, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+
+		m := refPattern.FindStringSubmatch(ref)
+		name, field, typ := m[1], m[2], m[3]
+
+		for _, active := range stack {
+			if active == name {
+				err = fmt.Errorf("recursive pattern reference: %v -> %v",
+					strings.Join(stack, " -> "), name)
+				return ""
+			}
+		}
+
+		def, exists := definitions[name]
+		if !exists {
+			def, exists = stdPatterns[name]
+		}
+		if !exists && !lenient {
+			err = fmt.Errorf("unknown pattern '%v'", name)
+			return ""
+		}
+
+		var sub string
+		if exists {
+			sub, err = expand(def, definitions, append(stack, name), lenient)
+			if err != nil {
+				return ""
+			}
+		}
+
+		if field == "" {
+			return "(?:" + sub + ")"
+		}
+		if typ != "" {
+			field += ":" + typ
+		}
+		return "(?<" + field + ">" + sub + ")"
+	})
+	return out, err
+}
+
+// translator rewrites a regular expression in Oniguruma syntax into go regexp
+// syntax. Lookaround assertions, atomic groups and possessive quantifiers are
+// rewritten into special named groups, which require the backtracker.
+type translator struct {
+	in  string
+	pos int
+	out strings.Builder
+
+	captures map[int]Capture
+
+	// groups holds the output offsets of the open groups
+	groups []int
+
+	// atom is the output offset of the last quantifiable expression or -1
+	atom int
+
+	// special counts the special groups, such that group names are unique
+	special   int
+	backtrack bool
+
+	// unsupported records the first construct not supported by the local
+	// runner. Captures can still be parsed.
+	unsupported error
+}
+
+var quantifierPattern = regexp.MustCompile(`^(?:[*+?]|\{[0-9]+(?:,[0-9]*)?\})`)
+
+var lookarounds = []struct{ prefix, group string }{
+	{"(?=", groupLookahead},
+	{"(?!", groupNegLookahead},
+	{"(?<=", groupLookbehind},
+	{"(?<!", groupNegLookbehind},
+	{"(?>", groupAtomic},
+}
+
+func newTranslator(in string) *translator {
+	return &translator{in: in, captures: map[int]Capture{}, atom: -1}
+}
+
+func (t *translator) translate() (string, error) {
+	for t.pos < len(t.in) {
+		c := t.in[t.pos]
+		start := t.out.Len()
+		switch {
+		case c == '\\':
+			t.escape()
+			t.atom = start
+		case c == '[':
+			if err := t.class(); err != nil {
+				return "", err
+			}
+			t.atom = start
+		case c == '(':
+			if err := t.group(); err != nil {
+				return "", err
+			}
+			t.atom = -1
+		case c == ')':
+			t.out.WriteByte(c)
+			t.pos++
+			t.atom = -1
+			if n := len(t.groups); n > 0 {
+				t.atom = t.groups[n-1]
+				t.groups = t.groups[:n-1]
+			}
+		case quantifierPattern.MatchString(t.in[t.pos:]):
+			t.quantifier()
+			t.atom = -1
+		case c == '|' || c == '^' || c == '$':
+			t.out.WriteByte(c)
+			t.pos++
+			t.atom = -1
+		default:
+			_, w := utf8.DecodeRuneInString(t.in[t.pos:])
+			t.out.WriteString(t.in[t.pos : t.pos+w])
+			t.pos += w
+			t.atom = start
+		}
+	}
+	return t.out.String(), nil
+}
+
+func (t *translator) peek(s string) bool {
+	return strings.HasPrefix(t.in[t.pos:], s)
+}
+
+func (t *translator) specialGroup(kind string) string {
+	t.backtrack = true
+	name := fmt.Sprintf("(?P<%v%v>", kind, t.special)
+	t.special++
+	return name
+}
+
+// quantifier copies a quantifier. Possessive quantifiers are rewritten into
+// an atomic group containing the quantified expression.
+func (t *translator) quantifier() {
+	q := quantifierPattern.FindString(t.in[t.pos:])
+	t.pos += len(q)
+
+	switch {
+	case t.peek("?"):
+		t.out.WriteString(q + "?")
+		t.pos++
+	case t.peek("+") && t.atom >= 0:
+		t.pos++
+		out := t.out.String()
+		t.out.Reset()
+		t.out.WriteString(out[:t.atom])
+		t.out.WriteString(t.specialGroup(groupAtomic))
+		t.out.WriteString(out[t.atom:])
+		t.out.WriteString(q + ")")
+	default:
+		t.out.WriteString(q)
+	}
+}
+
+func (t *translator) escape() {
+	if t.pos+1 >= len(t.in) {
+		t.out.WriteByte('\\')
+		t.pos++
+		return
+	}
+
+	seq := t.in[t.pos : t.pos+2]
+	switch {
+	case seq[1] >= '1' && seq[1] <= '9' || seq == `\k`:
+		if t.unsupported == nil {
+			t.unsupported = fmt.Errorf("backreference at offset %v not supported", t.pos)
+		}
+		t.out.WriteString(seq)
+	case seq == `\Z`:
+		t.out.WriteString(`\n?\z`)
+	case seq == `\h`:
+		t.out.WriteString(`[0-9a-fA-F]`)
+	case seq == `\H`:
+		t.out.WriteString(`[^0-9a-fA-F]`)
+	default:
+		t.out.WriteString(seq)
+	}
+	t.pos += 2
+}
+
+func (t *translator) class() error {
+	start := t.pos
+	t.pos++
+	if t.peek("^") {
+		t.pos++
+	}
+	if t.peek("]") {
+		t.pos++
+	}
+
+	for t.pos < len(t.in) {
+		switch {
+		case t.in[t.pos] == '\\':
+			t.pos += 2
+		case t.peek("[:"):
+			end := strings.Index(t.in[t.pos:], ":]")
+			if end < 0 {
+				return fmt.Errorf("unterminated character class at offset %v", start)
+			}
+			t.pos += end + 2
+		case t.in[t.pos] == ']':
+			t.pos++
+			t.out.WriteString(t.in[start:t.pos])
+			return nil
+		default:
+			t.pos++
+		}
+	}
+	return fmt.Errorf("unterminated character class at offset %v", start)
+}
+
+func (t *translator) group() error {
+	t.groups = append(t.groups, t.out.Len())
+
+	for _, l := range lookarounds {
+		if t.peek(l.prefix) {
+			t.out.WriteString(t.specialGroup(l.group))
+			t.pos += len(l.prefix)
+			return nil
+		}
+	}
+
+	switch {
+	case t.peek("(?<") || t.peek("(?P<"):
+		start := strings.IndexByte(t.in[t.pos:], '<') + t.pos + 1
+		end := strings.IndexByte(t.in[start:], '>')
+		if end < 0 {
+			return fmt.Errorf("unterminated group name at offset %v", t.pos)
+		}
+
+		name := t.in[start : start+end]
+		capture := Capture{Field: name}
+		if idx := strings.IndexByte(name, ':'); idx >= 0 {
+			capture = Capture{Field: name[:idx], Type: name[idx+1:]}
+		}
+
+		id := len(t.captures)
+		t.captures[id] = capture
+		fmt.Fprintf(&t.out, "(?P<grok%v>", id)
+		t.pos = start + end + 1
+
+	case t.peek("(?"):
+		// flags, like `(?i)` or `(?i:`
+		end := strings.IndexAny(t.in[t.pos:], ":)")
+		if end < 0 {
+			return fmt.Errorf("unterminated group at offset %v", t.pos)
+		}
+		if t.in[t.pos+end] == ')' {
+			t.groups = t.groups[:len(t.groups)-1]
+		}
+		t.out.WriteString(t.in[t.pos : t.pos+end+1])
+		t.pos += end + 1
+
+	default:
+		t.out.WriteByte('(')
+		t.pos++
+	}
+	return nil
+}
+
+func convert(value, typ string) (interface{}, error) {
+	switch typ {
+	case "":
+		return value, nil
+	case "int", "integer":
+		i, err := strconv.ParseInt(value, 10, 32)
+		return int(i), err
+	case "long":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		f, err := strconv.ParseFloat(value, 32)
+		return float32(f), err
+	case "double":
+		return strconv.ParseFloat(value, 64)
+	case "bool", "boolean":
+		return strings.EqualFold(value, "true"), nil
+	default:
+		return nil, fmt.Errorf("unknown type '%v'", typ)
+	}
+}
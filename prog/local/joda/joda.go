@@ -0,0 +1,204 @@
+// Package joda parses timestamps using Joda-Time format strings, as used by
+// the Logstash and Elasticsearch date processors.
+package joda
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout used to print timestamps. Matches the default output format of the
+// Ingest Node date processor.
+const Layout = "2006-01-02T15:04:05.000Z07:00"
+
+// Parse parses the value with the given Joda-Time format. Besides format
+// patterns the special formats ISO8601, UNIX, UNIX_MS and TAI64N are
+// supported. Timestamps without timezone information are parsed in loc. The
+// result is always converted into loc.
+func Parse(format, value string, loc *time.Location) (time.Time, error) {
+	switch format {
+	case "ISO8601":
+		return parseISO8601(value, loc)
+	case "UNIX":
+		secs, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(frac*1e9)).In(loc), nil
+	case "UNIX_MS":
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)).In(loc), nil
+	case "TAI64N":
+		return parseTAI64N(value, loc)
+	}
+
+	layout, err := ToLayout(format)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ts, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return ts, err
+	}
+
+	// Joda defaults the year to the current year if the format has no year.
+	if ts.Year() == 0 {
+		ts = ts.AddDate(time.Now().In(loc).Year(), 0, 0)
+	}
+	return ts.In(loc), nil
+}
+
+var isoLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseISO8601(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range isoLayouts {
+		if ts, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return ts.In(loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid ISO8601 timestamp '%v'", value)
+}
+
+func parseTAI64N(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimPrefix(value, "@")
+	if len(value) != 24 {
+		return time.Time{}, fmt.Errorf("invalid TAI64N timestamp '%v'", value)
+	}
+
+	secs, err := strconv.ParseUint(value[:16], 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanos, err := strconv.ParseUint(value[16:], 16, 32)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(secs-(1<<62)), int64(nanos)).In(loc), nil
+}
+
+// ToLayout converts a Joda-Time format string into a go time layout.
+func ToLayout(format string) (string, error) {
+	var out strings.Builder
+
+	for i := 0; i < len(format); {
+		c := format[i]
+
+		// quoted literal
+		if c == '\'' {
+			end := strings.IndexByte(format[i+1:], '\'')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated literal in '%v'", format)
+			}
+			if end == 0 {
+				out.WriteByte('\'')
+			} else {
+				out.WriteString(format[i+1 : i+1+end])
+			}
+			i += end + 2
+			continue
+		}
+
+		if !isLetter(c) {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		n := 1
+		for i+n < len(format) && format[i+n] == c {
+			n++
+		}
+		i += n
+
+		elem, err := layoutElem(c, n)
+		if err != nil {
+			return "", fmt.Errorf("%v in '%v'", err, format)
+		}
+		out.WriteString(elem)
+	}
+
+	return out.String(), nil
+}
+
+func layoutElem(c byte, n int) (string, error) {
+	pick := func(short, long string) string {
+		if n == 1 {
+			return short
+		}
+		return long
+	}
+
+	switch c {
+	case 'y', 'Y', 'x':
+		if n == 2 {
+			return "06", nil
+		}
+		return "2006", nil
+	case 'M':
+		switch n {
+		case 1:
+			return "1", nil
+		case 2:
+			return "01", nil
+		case 3:
+			return "Jan", nil
+		default:
+			return "January", nil
+		}
+	case 'd':
+		return pick("2", "02"), nil
+	case 'D':
+		return "002", nil
+	case 'H', 'k':
+		return "15", nil
+	case 'h', 'K':
+		return pick("3", "03"), nil
+	case 'm':
+		return pick("4", "04"), nil
+	case 's':
+		return pick("5", "05"), nil
+	case 'S':
+		return strings.Repeat("0", n), nil
+	case 'E':
+		if n <= 3 {
+			return "Mon", nil
+		}
+		return "Monday", nil
+	case 'a':
+		return "PM", nil
+	case 'Z':
+		switch n {
+		case 1:
+			return "-0700", nil
+		case 2:
+			return "-07:00", nil
+		default:
+			return "MST", nil
+		}
+	case 'z':
+		return "MST", nil
+	}
+
+	return "", fmt.Errorf("unsupported format element '%v'", strings.Repeat(string(c), n))
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
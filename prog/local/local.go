@@ -0,0 +1,266 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pipeline is executed in process. The execution semantics follow the
+// Elasticsearch Ingest Node: processors are run in order and the first error
+// stops the pipeline and triggers the OnFailure processors.
+type Pipeline struct {
+	Description string
+	Processors  []Processor
+	OnFailure   []Processor
+}
+
+// Processor modifies a document in place.
+type Processor func(doc Document) error
+
+// Document is the event being processed. Fields are addressed by dotted
+// paths, like 'apache2.access.remote_ip'.
+type Document map[string]interface{}
+
+const (
+	metaField      = "_ingest"
+	failureMessage = metaField + ".on_failure_message"
+)
+
+func Single(p Processor) []Processor {
+	return []Processor{p}
+}
+
+// IgnoreFailure wraps a processor, such that errors are discarded.
+func IgnoreFailure(ignore bool, p Processor) Processor {
+	if !ignore {
+		return p
+	}
+	return func(doc Document) error {
+		p(doc)
+		return nil
+	}
+}
+
+func RemoveField(name string) Processor {
+	return func(doc Document) error {
+		doc.Delete(name)
+		return nil
+	}
+}
+
+func (p *Pipeline) Run(doc Document) error {
+	if len(p.OnFailure) == 0 {
+		return Run(p.Processors, doc)
+	}
+	return Try(p.Processors, p.OnFailure)(doc)
+}
+
+// Try creates a processor running the processors in order. On error the
+// remaining processors are skipped and the onFailure processors are run. The
+// error message is available to the onFailure processors via FailureMessage.
+func Try(processors, onFailure []Processor) Processor {
+	return func(doc Document) error {
+		err := Run(processors, doc)
+		if err == nil {
+			return nil
+		}
+
+		// restore the message of enclosing handlers when done
+		old, nested := doc.Get(failureMessage)
+		doc.Put(failureMessage, err.Error())
+		err = Run(onFailure, doc)
+		if nested {
+			doc.Put(failureMessage, old)
+		} else {
+			doc.Delete(metaField)
+		}
+		return err
+	}
+}
+
+func Run(processors []Processor, doc Document) error {
+	for _, p := range processors {
+		if err := p(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailureMessage returns the error message of the failed processor, if the
+// document is processed by an on failure handler.
+func (d Document) FailureMessage() string {
+	msg, _ := d.Get(failureMessage)
+	s, _ := msg.(string)
+	return s
+}
+
+func (d Document) Has(path string) bool {
+	_, ok := d.Get(path)
+	return ok
+}
+
+func (d Document) Get(path string) (interface{}, bool) {
+	var cur interface{} = map[string]interface{}(d)
+	for _, name := range strings.Split(path, ".") {
+		m, ok := toMap(cur)
+		if !ok {
+			return nil, false
+		}
+
+		cur, ok = m[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Field returns the fields value. Missing or null fields are reported as
+// error, unless ignoreMissing is set. If the value is missing or null, ok
+// is false.
+func (d Document) Field(path string, ignoreMissing bool) (v interface{}, ok bool, err error) {
+	v, exists := d.Get(path)
+	switch {
+	case exists && v != nil:
+		return v, true, nil
+	case ignoreMissing:
+		return nil, false, nil
+	case !exists:
+		return nil, false, fmt.Errorf("field [%v] not present as part of path [%v]", path, path)
+	default:
+		return nil, false, fmt.Errorf("field [%v] is null", path)
+	}
+}
+
+// StringField returns the fields string value. Like Field, but also reports an
+// error if the value is no string.
+func (d Document) StringField(path string, ignoreMissing bool) (s string, ok bool, err error) {
+	v, ok, err := d.Field(path, ignoreMissing)
+	if !ok {
+		return "", ok, err
+	}
+
+	s, isString := v.(string)
+	if !isString {
+		return "", false, fmt.Errorf("field [%v] of type [%T] cannot be cast to string", path, v)
+	}
+	return s, true, nil
+}
+
+// Put sets the field value, creating missing intermediate objects.
+func (d Document) Put(path string, value interface{}) error {
+	m, name, err := d.parent(path, true)
+	if err != nil {
+		return err
+	}
+
+	m[name] = value
+	return nil
+}
+
+// Append adds the value to the field. An existing non-list value is converted
+// into a list.
+func (d Document) Append(path string, value interface{}) error {
+	m, name, err := d.parent(path, true)
+	if err != nil {
+		return err
+	}
+
+	old, exists := m[name]
+	if !exists {
+		m[name] = value
+		return nil
+	}
+
+	list, ok := old.([]interface{})
+	if !ok {
+		list = []interface{}{old}
+	}
+	m[name] = append(list, value)
+	return nil
+}
+
+// Delete removes the field from the document. Returns false if the field did
+// not exist.
+func (d Document) Delete(path string) bool {
+	m, name, err := d.parent(path, false)
+	if err != nil || m == nil {
+		return false
+	}
+
+	if _, exists := m[name]; !exists {
+		return false
+	}
+	delete(m, name)
+	return true
+}
+
+func (d Document) parent(path string, create bool) (map[string]interface{}, string, error) {
+	if path == "" {
+		return nil, "", errors.New("path cannot be empty")
+	}
+
+	names := strings.Split(path, ".")
+	last := len(names) - 1
+
+	m := map[string]interface{}(d)
+	for _, name := range names[:last] {
+		child, exists := m[name]
+		if !exists {
+			if !create {
+				return nil, "", nil
+			}
+
+			tmp := map[string]interface{}{}
+			m[name] = tmp
+			m = tmp
+			continue
+		}
+
+		sub, ok := toMap(child)
+		if !ok {
+			return nil, "", fmt.Errorf("cannot add field [%v] to [%v] of type [%T]", path, name, child)
+		}
+		m = sub
+	}
+
+	return m, names[last], nil
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case Document:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// ToString converts a value into its string representation. Floating point
+// numbers are not formatted using exponents.
+func ToString(v interface{}) string {
+	switch f := v.(type) {
+	case float64:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// SplitRegex splits s around the matches of re. Like java.lang.String.split,
+// trailing empty strings are removed.
+func SplitRegex(re *regexp.Regexp, s string) []string {
+	parts := re.Split(s, -1)
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
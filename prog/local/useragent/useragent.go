@@ -0,0 +1,131 @@
+// Package useragent implements a small user agent parser. It recognizes the
+// most common browsers, operating systems and devices, using the field layout
+// of the Elasticsearch ingest user_agent processor. The parser does not use
+// the uap-core regex database, so results for rare agents will differ from
+// Elasticsearch.
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+type rule struct {
+	re   *regexp.Regexp
+	name string
+}
+
+var browsers = []rule{
+	{regexp.MustCompile(`(?:Edge|Edg|EdgA|EdgiOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Edge"},
+	{regexp.MustCompile(`(?:OPR|Opera)/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Opera"},
+	{regexp.MustCompile(`(?i)(?:Googlebot)/(\d+)(?:\.(\d+))?`), "Googlebot"},
+	{regexp.MustCompile(`(?i)(?:bingbot)/(\d+)(?:\.(\d+))?`), "bingbot"},
+	{regexp.MustCompile(`CriOS/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Chrome Mobile iOS"},
+	{regexp.MustCompile(`Chrome/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Mobile`), "Chrome Mobile"},
+	{regexp.MustCompile(`Chrome/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Chrome"},
+	{regexp.MustCompile(`FxiOS/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Firefox iOS"},
+	{regexp.MustCompile(`Firefox/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Mobile|Mobile.*Firefox/(\d+)(?:\.(\d+))?`), "Firefox Mobile"},
+	{regexp.MustCompile(`Firefox/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Firefox"},
+	{regexp.MustCompile(`Version/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Mobile.*Safari`), "Mobile Safari"},
+	{regexp.MustCompile(`Version/(\d+)(?:\.(\d+))?(?:\.(\d+))?.*Safari`), "Safari"},
+	{regexp.MustCompile(`MSIE (\d+)(?:\.(\d+))?`), "IE"},
+	{regexp.MustCompile(`Trident/.*rv:(\d+)(?:\.(\d+))?`), "IE"},
+	{regexp.MustCompile(`^curl/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "curl"},
+	{regexp.MustCompile(`^Wget/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Wget"},
+	{regexp.MustCompile(`^Go-http-client/(\d+)(?:\.(\d+))?`), "Go-http-client"},
+	{regexp.MustCompile(`^python-requests/(\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Python Requests"},
+}
+
+var operatingSystems = []rule{
+	{regexp.MustCompile(`Windows NT (\d+)\.(\d+)`), "Windows"},
+	{regexp.MustCompile(`(?:iPhone|CPU) OS (\d+)(?:_(\d+))?(?:_(\d+))?`), "iOS"},
+	{regexp.MustCompile(`Mac OS X (\d+)(?:[_.](\d+))?(?:[_.](\d+))?`), "Mac OS X"},
+	{regexp.MustCompile(`Android (\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Android"},
+	{regexp.MustCompile(`CrOS \w+ (\d+)(?:\.(\d+))?(?:\.(\d+))?`), "Chrome OS"},
+	{regexp.MustCompile(`Ubuntu`), "Ubuntu"},
+	{regexp.MustCompile(`Linux`), "Linux"},
+}
+
+var windowsVersions = map[string]string{
+	"10.0": "Windows 10",
+	"6.3":  "Windows 8.1",
+	"6.2":  "Windows 8",
+	"6.1":  "Windows 7",
+	"6.0":  "Windows Vista",
+	"5.2":  "Windows XP",
+	"5.1":  "Windows XP",
+}
+
+var devices = []rule{
+	{regexp.MustCompile(`iPhone`), "iPhone"},
+	{regexp.MustCompile(`iPad`), "iPad"},
+	{regexp.MustCompile(`iPod`), "iPod"},
+	{regexp.MustCompile(`(?i)bot|spider|crawler`), "Spider"},
+	{regexp.MustCompile(`Android.*Mobile`), "Generic Smartphone"},
+	{regexp.MustCompile(`Android`), "Generic Tablet"},
+}
+
+// Parse returns the user agent details.
+func Parse(agent string) map[string]interface{} {
+	info := map[string]interface{}{
+		"name":   "Other",
+		"os":     "Other",
+		"device": "Other",
+	}
+
+	if name, version := match(browsers, agent); name != "" {
+		info["name"] = name
+		addVersion(info, "", version)
+	}
+
+	if name, version := match(operatingSystems, agent); name != "" {
+		if name == "Windows" && len(version) >= 2 {
+			if full, ok := windowsVersions[version[0]+"."+version[1]]; ok {
+				name, version = full, nil
+			}
+		}
+
+		info["os_name"] = name
+		addVersion(info, "os_", version)
+
+		full := name
+		if len(version) > 0 {
+			full += " " + strings.Join(version, ".")
+		}
+		info["os"] = full
+	}
+
+	if name, _ := match(devices, agent); name != "" {
+		info["device"] = name
+	}
+
+	return info
+}
+
+func match(rules []rule, agent string) (string, []string) {
+	for _, r := range rules {
+		m := r.re.FindStringSubmatch(agent)
+		if m == nil {
+			continue
+		}
+
+		var version []string
+		for _, v := range m[1:] {
+			if v != "" {
+				version = append(version, v)
+			}
+		}
+		return r.name, version
+	}
+	return "", nil
+}
+
+func addVersion(info map[string]interface{}, prefix string, version []string) {
+	names := []string{"major", "minor", "patch"}
+	for i, v := range version {
+		if i >= len(names) || prefix != "" && i > 1 {
+			break
+		}
+		info[prefix+names[i]] = v
+	}
+}
@@ -1,6 +1,10 @@
 package ls
 
-import "github.com/urso/go-structform/gotype"
+import (
+	"strings"
+
+	"github.com/urso/go-structform/gotype"
+)
 
 // statement types
 type (
@@ -19,6 +23,13 @@ type (
 		Cond []Case
 		Else Block
 	}
+
+	// Raw holds Logstash configuration text, that is added to the output as
+	// is.
+	Raw string
+
+	// Comment is added to the output as comment line.
+	Comment string
 )
 
 type Expression string
@@ -97,7 +108,7 @@ func (c Conditional) format(ctx *formatCtx) error {
 	ctx.withIndent(ifClause.Block.format)
 
 	for _, clause := range elifClauses {
-		ctx.Printf("} elif %v {\n", clause.Cond)
+		ctx.Printf("} else if %v {\n", clause.Cond)
 		ctx.withIndent(clause.Block.format)
 	}
 
@@ -109,9 +120,20 @@ func (c Conditional) format(ctx *formatCtx) error {
 	return ctx.Println("}")
 }
 
+func (r Raw) format(ctx *formatCtx) error {
+	return ctx.Println(strings.TrimRight(string(r), "\n"))
+}
+
+func (c Comment) format(ctx *formatCtx) error {
+	for _, line := range strings.Split(string(c), "\n") {
+		ctx.Println("# " + line)
+	}
+	return ctx.Err()
+}
+
 func (f Filter) format(ctx *formatCtx) error {
 	if len(f.Params) == 0 {
-		return ctx.Printf("%v {}", f.Name)
+		return ctx.Printf("%v {}\n", f.Name)
 	}
 
 	ctx.Printf("%v ", f.Name)
@@ -86,3 +86,15 @@ func Serialize(out io.Writer, p Pipeline) error {
 	ctx.withIndent(blk.format)
 	return ctx.Println("}")
 }
+
+// FormatBlock writes the statements in Logstash configuration syntax.
+func FormatBlock(out io.Writer, blk Block) error {
+	ctx := &formatCtx{
+		out:    out,
+		indent: "    ",
+	}
+	if err := blk.format(ctx); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,488 @@
+package ls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Section is a top-level plugin section of a Logstash configuration, like
+// `filter { ... }`.
+type Section struct {
+	Type  string
+	Block Block
+}
+
+type parser struct {
+	in  string
+	pos int
+}
+
+// Parse parses a Logstash configuration. Conditions are not interpreted, but
+// stored as is in the Conditional statements.
+//
+// Hashes are returned as Params, arrays as []interface{} and numbers as int64
+// or float64. Barewords are returned as strings, except for `true` and
+// `false`, which are returned as bool.
+func Parse(in string) ([]Section, error) {
+	p := &parser{in: in}
+
+	var sections []Section
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return sections, nil
+		}
+
+		typ, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		blk, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		sections = append(sections, Section{Type: typ, Block: blk})
+	}
+}
+
+// FieldPath converts a field reference like `[a][b]` into a dotted field name.
+// It is the inverse of NormalizeField.
+func FieldPath(ref string) string {
+	if !strings.HasPrefix(ref, "[") || !strings.HasSuffix(ref, "]") {
+		return ref
+	}
+	return strings.Join(strings.Split(ref[1:len(ref)-1], "]["), ".")
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.in)
+}
+
+func (p *parser) peek(s string) bool {
+	return strings.HasPrefix(p.in[p.pos:], s)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.in[:p.pos], "\n")
+	col := p.pos - strings.LastIndexByte(p.in[:p.pos], '\n')
+	return fmt.Errorf("line %v, column %v: %v", line, col, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(s string) error {
+	p.skipSpace()
+	if !p.peek(s) {
+		if p.eof() {
+			return p.errorf("expected '%v', got end of input", s)
+		}
+		return p.errorf("expected '%v'", s)
+	}
+	p.pos += len(s)
+	return nil
+}
+
+// skipSpace skips whitespace and comments.
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		switch c := p.in[p.pos]; {
+		case c == '#':
+			end := strings.IndexByte(p.in[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.in)
+				return
+			}
+			p.pos += end
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// keyword checks if the next token is the keyword kw and consumes it.
+func (p *parser) keyword(kw string) bool {
+	p.skipSpace()
+	if !p.peek(kw) {
+		return false
+	}
+
+	end := p.pos + len(kw)
+	if end < len(p.in) && isWordChar(p.in[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *parser) parseBlock() (Block, error) {
+	blk := MakeBlock()
+	for {
+		p.skipSpace()
+		switch {
+		case p.eof():
+			return nil, p.errorf("expected '}', got end of input")
+		case p.peek("}"):
+			p.pos++
+			return blk, nil
+		case p.keyword("if"):
+			cond, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			blk = append(blk, cond)
+		default:
+			filter, err := p.parsePlugin()
+			if err != nil {
+				return nil, err
+			}
+			blk = append(blk, filter)
+		}
+	}
+}
+
+// parseConditional parses an if statement, with the `if` keyword already
+// consumed.
+func (p *parser) parseConditional() (Conditional, error) {
+	var stmt Conditional
+	for {
+		cond, err := p.parseCondition()
+		if err != nil {
+			return stmt, err
+		}
+		if err := p.expect("{"); err != nil {
+			return stmt, err
+		}
+		blk, err := p.parseBlock()
+		if err != nil {
+			return stmt, err
+		}
+		stmt.Cond = append(stmt.Cond, Case{Cond: cond, Block: blk})
+
+		if !p.keyword("else") {
+			return stmt, nil
+		}
+		if p.keyword("if") {
+			continue
+		}
+
+		if err := p.expect("{"); err != nil {
+			return stmt, err
+		}
+		if stmt.Else, err = p.parseBlock(); err != nil {
+			return stmt, err
+		}
+		return stmt, nil
+	}
+}
+
+// parseCondition reads the condition up to the opening brace of the block.
+func (p *parser) parseCondition() (Expression, error) {
+	p.skipSpace()
+	start := p.pos
+	depth := 0
+	regexAllowed := false
+
+	for !p.eof() {
+		c := p.in[p.pos]
+		switch {
+		case c == '"' || c == '\'':
+			if _, err := p.parseString(); err != nil {
+				return "", err
+			}
+			regexAllowed = false
+			continue
+
+		case c == '/' && regexAllowed:
+			end := p.pos + 1
+			for end < len(p.in) && p.in[end] != '/' {
+				if p.in[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(p.in) {
+				return "", p.errorf("unterminated regular expression")
+			}
+			p.pos = end + 1
+			regexAllowed = false
+			continue
+
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == '{' && depth == 0:
+			cond := strings.TrimSpace(p.in[start:p.pos])
+			if cond == "" {
+				return "", p.errorf("missing condition")
+			}
+			return Expression(cond), nil
+		}
+
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			regexAllowed = p.peek("=~") || p.peek("!~")
+			if regexAllowed {
+				p.pos++
+			}
+		}
+		p.pos++
+	}
+	return "", p.errorf("expected '{', got end of input")
+}
+
+func (p *parser) parsePlugin() (Filter, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return Filter{}, err
+	}
+	if err := p.expect("{"); err != nil {
+		return Filter{}, err
+	}
+
+	params := Params{}
+	for {
+		p.skipSpace()
+		if p.peek("}") {
+			p.pos++
+			return MakeFilter(name, params), nil
+		}
+
+		setting, err := p.parseName()
+		if err != nil {
+			return Filter{}, err
+		}
+		if err := p.expect("=>"); err != nil {
+			return Filter{}, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return Filter{}, err
+		}
+
+		if err := addSetting(params, setting, value); err != nil {
+			return Filter{}, p.errorf("%v in %v", err, name)
+		}
+	}
+}
+
+// addSetting adds a plugin setting. Like Logstash, repeated list and hash
+// settings are merged.
+func addSetting(params Params, name string, value interface{}) error {
+	old, exists := params[name]
+	if !exists {
+		params[name] = value
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if list, ok := old.([]interface{}); ok {
+			params[name] = append(list, v...)
+			return nil
+		}
+	case Params:
+		if hash, ok := old.(Params); ok {
+			for k, x := range v {
+				hash[k] = x
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("duplicate setting '%v'", name)
+}
+
+func (p *parser) parseName() (string, error) {
+	p.skipSpace()
+	if p.eof() {
+		return "", p.errorf("expected name, got end of input")
+	}
+
+	if c := p.in[p.pos]; c == '"' || c == '\'' {
+		return p.parseString()
+	}
+	return p.parseBareword()
+}
+
+func (p *parser) parseBareword() (string, error) {
+	start := p.pos
+	for !p.eof() && isWordChar(p.in[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("unexpected character '%c'", p.in[p.pos])
+	}
+	return p.in[start:p.pos], nil
+}
+
+// parseString parses a quoted string. Escaped quotes are unescaped, other
+// escape sequences are kept as is.
+func (p *parser) parseString() (string, error) {
+	quote := p.in[p.pos]
+	start := p.pos
+	p.pos++
+
+	var buf strings.Builder
+	for !p.eof() {
+		c := p.in[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.in) && p.in[p.pos+1] == quote:
+			buf.WriteByte(quote)
+			p.pos += 2
+		case c == '\\' && p.pos+1 < len(p.in):
+			buf.WriteString(p.in[p.pos : p.pos+2])
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("expected value, got end of input")
+	}
+
+	switch c := p.in[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseHash()
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	}
+
+	word, err := p.parseBareword()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.peek("{") {
+		return nil, p.errorf("plugin values are not supported")
+	}
+
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return word, nil
+}
+
+func (p *parser) parseArray() ([]interface{}, error) {
+	p.pos++ // '['
+
+	list := []interface{}{}
+	for {
+		p.skipSpace()
+		if p.peek("]") {
+			p.pos++
+			return list, nil
+		}
+
+		if len(list) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+}
+
+func (p *parser) parseHash() (Params, error) {
+	p.pos++ // '{'
+
+	hash := Params{}
+	for {
+		p.skipSpace()
+		if p.peek("}") {
+			p.pos++
+			return hash, nil
+		}
+
+		var key string
+		if c := p.in[p.pos]; c == '-' || isDigit(c) {
+			n, err := p.parseNumber()
+			if err != nil {
+				return nil, err
+			}
+			key = fmt.Sprint(n)
+		} else {
+			var err error
+			if key, err = p.parseName(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		hash[key] = value
+
+		// entries are separated by whitespace, but accept commas as well
+		p.skipSpace()
+		if p.peek(",") {
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) parseNumber() (interface{}, error) {
+	start := p.pos
+	if p.peek("-") {
+		p.pos++
+	}
+	for !p.eof() && (isDigit(p.in[p.pos]) || p.in[p.pos] == '.') {
+		p.pos++
+	}
+
+	s := p.in[start:p.pos]
+	if strings.Contains(s, ".") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number '%v'", s)
+		}
+		return f, nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number '%v'", s)
+	}
+	return i, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,153 @@
+// Package template implements string values referencing event fields, that
+// can be compiled to Ingest Node mustache templates and Logstash sprintf
+// formats, or rendered locally.
+//
+// Fields are referenced by dotted paths in double braces:
+//
+//	{{source.ip}}
+//	{{ apache2.access.method }} {{apache2.access.url}}
+//
+// Triple braces, as used by mustache to disable HTML escaping, are accepted
+// as well. Missing fields and fields with null values are rendered as empty
+// strings. Logstash keeps references to missing fields as is.
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urso/bpb/prog/local"
+	"github.com/urso/bpb/prog/ls"
+)
+
+// Template is a parsed template.
+type Template struct {
+	src   string
+	parts []part
+}
+
+// part is either a literal text or a field reference.
+type part struct {
+	text  string
+	field string
+}
+
+var (
+	reference   = regexp.MustCompile(`\{\{\{?\s*([^{}\s]*)\s*\}?\}\}`)
+	lsReference = regexp.MustCompile(`%\{([^}]*)\}`)
+)
+
+// Parse parses a template.
+func Parse(s string) (*Template, error) {
+	t := &Template{src: s}
+
+	pos := 0
+	for _, m := range reference.FindAllStringSubmatchIndex(s, -1) {
+		ref := s[m[0]:m[1]]
+		if strings.HasPrefix(ref, "{{{") != strings.HasSuffix(ref, "}}}") {
+			return nil, fmt.Errorf("offset %v: unbalanced braces in '%v'", m[0], ref)
+		}
+
+		name := s[m[2]:m[3]]
+		if name == "" || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+			return nil, fmt.Errorf("offset %v: invalid field name '%v'", m[0], name)
+		}
+
+		if m[0] > pos {
+			t.parts = append(t.parts, part{text: s[pos:m[0]]})
+		}
+		t.parts = append(t.parts, part{field: name})
+		pos = m[1]
+	}
+	if pos < len(s) {
+		t.parts = append(t.parts, part{text: s[pos:]})
+	}
+
+	for _, p := range t.parts {
+		if strings.Contains(p.text, "{{") {
+			return nil, fmt.Errorf("invalid field reference in '%v'", s)
+		}
+	}
+	return t, nil
+}
+
+// FromLogstash converts a Logstash sprintf format into a template. Formats
+// using date or time formats are not supported.
+func FromLogstash(s string) (*Template, error) {
+	var err error
+	converted := lsReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if name == "" || strings.HasPrefix(name, "+") || name == "{" {
+			err = fmt.Errorf("reference '%v' not supported", ref)
+			return ref
+		}
+		return "{{" + ls.FieldPath(name) + "}}"
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Parse(converted)
+}
+
+func (t *Template) String() string { return t.src }
+
+// Fields returns the names of the referenced fields.
+func (t *Template) Fields() []string {
+	var fields []string
+	for _, p := range t.parts {
+		if p.field != "" {
+			fields = append(fields, p.field)
+		}
+	}
+	return fields
+}
+
+// IsConstant checks the template does not reference any fields.
+func (t *Template) IsConstant() bool {
+	return len(t.Fields()) == 0
+}
+
+// MayBeEmpty checks the template renders the empty string if the referenced
+// fields are missing or empty.
+func (t *Template) MayBeEmpty() bool {
+	for _, p := range t.parts {
+		if p.text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// CompileIngest creates the mustache template.
+func (t *Template) CompileIngest() string {
+	return t.format(func(name string) string { return "{{" + name + "}}" })
+}
+
+// CompileLogstash creates the sprintf format.
+func (t *Template) CompileLogstash() string {
+	return t.format(func(name string) string { return "%{" + ls.NormalizeField(name) + "}" })
+}
+
+// Render renders the template using the documents fields.
+func (t *Template) Render(doc local.Document) string {
+	return t.format(func(name string) string {
+		v, ok := doc.Get(name)
+		if !ok || v == nil {
+			return ""
+		}
+		return local.ToString(v)
+	})
+}
+
+func (t *Template) format(ref func(string) string) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.field != "" {
+			b.WriteString(ref(p.field))
+		} else {
+			b.WriteString(p.text)
+		}
+	}
+	return b.String()
+}
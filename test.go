@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/urso/bpb/generator"
+)
+
+// testCase is read from a test file. The input is either a plain log line or
+// a JSON event.
+type testCase struct {
+	Input    interface{}            `json:"input"`
+	Expected map[string]interface{} `json:"expected"`
+}
+
+type processFunc func(*generator.Generator, []map[string]interface{}) ([]map[string]interface{}, error)
+
+func cmdTest() *cobra.Command {
+	var (
+		backend string
+		host    string
+		lsHome  string
+		update  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Run pipeline test cases",
+		Long: `Run the test cases next to each pipeline file. The test cases for
+'<dir>/<name>.yml' are read from '<dir>/<name>.test.json' and
+'<dir>/<name>.<case>.test.json'. Each test file holds a JSON object with the
+'input' line or event and the 'expected' document.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			process, err := findProcessFunc(backend, host, lsHome)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			ok := true
+			for _, file := range args {
+				passed, err := runPipelineTests(file, backend, process, update)
+				if err != nil {
+					log.Fatal(err)
+				}
+				ok = ok && passed
+			}
+
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&backend, "backend", "local", "backend to run tests with (one of local, ingest or logstash)")
+	cmd.PersistentFlags().StringVar(&host, "host", "http://localhost:9200", "Ingest node URL")
+	cmd.PersistentFlags().StringVar(&lsHome, "lshome", "", "logstash home path")
+	cmd.PersistentFlags().BoolVar(&update, "update", false, "update expected documents with the actual results")
+	return cmd
+}
+
+func findProcessFunc(backend, host, lsHome string) (processFunc, error) {
+	switch backend {
+	case "local":
+		return localProcess, nil
+	case "ingest":
+		return func(gen *generator.Generator, events []map[string]interface{}) ([]map[string]interface{}, error) {
+			docs, err := ingestProcess(gen, host, events)
+			for _, doc := range docs {
+				normalizeIngestDoc(doc)
+			}
+			return docs, err
+		}, nil
+	case "logstash":
+		return func(gen *generator.Generator, events []map[string]interface{}) ([]map[string]interface{}, error) {
+			docs, err := lsProcess(lsHome, gen, &generator.LogstashCtx{}, events)
+			for _, doc := range docs {
+				normalizeLogstashDoc(doc)
+			}
+			return docs, err
+		}, nil
+	default:
+		return nil, fmt.Errorf("backend '%v' not supported", backend)
+	}
+}
+
+// findTestFiles returns the test files for the pipeline file.
+func findTestFiles(pipelineFile string) ([]string, error) {
+	base := strings.TrimSuffix(pipelineFile, filepath.Ext(pipelineFile))
+
+	files, err := filepath.Glob(base + ".test.json")
+	if err != nil {
+		return nil, err
+	}
+
+	cases, err := filepath.Glob(base + ".*.test.json")
+	if err != nil {
+		return nil, err
+	}
+	return append(files, cases...), nil
+}
+
+// runPipelineTests runs the test cases of a pipeline file with the given
+// backend.
+func runPipelineTests(pipelineFile, backend string, process processFunc, update bool) (bool, error) {
+	files, err := findTestFiles(pipelineFile)
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		fmt.Printf("?    %v: no test files\n", pipelineFile)
+		return true, nil
+	}
+
+	gen, err := loadPipeline([]string{pipelineFile})
+	if err != nil {
+		return false, err
+	}
+
+	cases := make([]testCase, len(files))
+	events := make([]map[string]interface{}, len(files))
+	for i, file := range files {
+		if cases[i], err = readTestCase(file); err != nil {
+			return false, fmt.Errorf("%v: %v", file, err)
+		}
+		if events[i], err = cases[i].event(); err != nil {
+			return false, fmt.Errorf("%v: %v", file, err)
+		}
+	}
+
+	docs, err := process(gen, events)
+	if err != nil {
+		return false, fmt.Errorf("%v: %v", pipelineFile, err)
+	}
+	if len(docs) != len(cases) {
+		return false, fmt.Errorf("%v: expected %v documents, but got %v", pipelineFile, len(cases), len(docs))
+	}
+
+	ok := true
+	for i, file := range files {
+		if backend == "logstash" {
+			dropLogstashTimestamp(events[i], cases[i].Expected, docs[i])
+		}
+
+		actual, err := normalizeJSON(docs[i])
+		if err != nil {
+			return false, err
+		}
+
+		if update {
+			cases[i].Expected = actual
+			if err := writeTestCase(file, cases[i]); err != nil {
+				return false, err
+			}
+			fmt.Printf("UPDATE %v\n", file)
+			continue
+		}
+
+		diffs := diffDocs(cases[i].Expected, actual)
+		if len(diffs) == 0 {
+			fmt.Printf("PASS %v\n", file)
+			continue
+		}
+
+		ok = false
+		fmt.Printf("FAIL %v\n", file)
+		for _, d := range diffs {
+			fmt.Printf("    %v\n", d)
+		}
+	}
+
+	return ok, nil
+}
+
+func readTestCase(file string) (testCase, error) {
+	var tc testCase
+
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return tc, err
+	}
+
+	err = json.Unmarshal(raw, &tc)
+	return tc, err
+}
+
+func writeTestCase(file string, tc testCase) error {
+	raw, err := json.MarshalIndent(tc, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(raw, '\n'), 0644)
+}
+
+func (tc testCase) event() (map[string]interface{}, error) {
+	switch in := tc.Input.(type) {
+	case string:
+		return map[string]interface{}{"message": in}, nil
+	case map[string]interface{}:
+		// copy the event, so the test case input is not modified
+		event := map[string]interface{}{}
+		raw, _ := json.Marshal(in)
+		err := json.Unmarshal(raw, &event)
+		return event, err
+	default:
+		return nil, fmt.Errorf("invalid test input type %T", tc.Input)
+	}
+}